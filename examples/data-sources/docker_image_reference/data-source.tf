@@ -0,0 +1,7 @@
+data "docker_image_reference" "app" {
+  reference = "ghcr.io/owner/app:1.0"
+}
+
+output "repository" {
+  value = "${data.docker_image_reference.app.registry}/${data.docker_image_reference.app.repository}"
+}
@@ -0,0 +1,5 @@
+data "docker_registries" "configured" {}
+
+output "registries_without_credentials" {
+  value = [for r in data.docker_registries.configured.registries : r.host if !r.has_credentials]
+}
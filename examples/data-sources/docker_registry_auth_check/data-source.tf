@@ -0,0 +1,8 @@
+data "docker_registry_auth_check" "ghcr" {
+  registry = "ghcr.io"
+  scope    = "repository:owner/app:pull"
+}
+
+output "ghcr_credentials_valid" {
+  value = data.docker_registry_auth_check.ghcr.authenticated
+}
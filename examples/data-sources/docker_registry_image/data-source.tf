@@ -6,3 +6,22 @@ resource "docker_image" "ubuntu" {
   name          = data.docker_registry_image.ubuntu.name
   pull_triggers = [data.docker_registry_image.ubuntu.sha256_digest]
 }
+
+# Deploys exactly the image read, e.g. docker.io/library/ubuntu@sha256:...
+resource "docker_image" "ubuntu_pinned" {
+  name = data.docker_registry_image.ubuntu.pinned_reference
+}
+
+# The reference can be given in parts instead, e.g. from variables
+data "docker_registry_image" "app" {
+  registry   = var.registry
+  repository = "owner/app"
+  tag        = var.app_version
+}
+
+# Reads the image of the highest 1.x release, e.g. 1.4.2, which is returned in resolved_tag
+data "docker_registry_image" "app_release" {
+  name               = "registry.example.com/owner/app"
+  tag_must_be_semver = true
+  semver_constraint  = "~> 1.0"
+}
@@ -0,0 +1,7 @@
+data "docker_registry_image_manifest" "alpine" {
+  name = "alpine:3.16"
+}
+
+output "alpine_annotations" {
+  value = lookup(jsondecode(data.docker_registry_image_manifest.alpine.manifest_json), "annotations", {})
+}
@@ -0,0 +1,8 @@
+data "docker_registry_referrers" "signatures" {
+  name          = "ghcr.io/owner/app:1.0"
+  artifact_type = "application/vnd.dev.cosign.artifact.sig.v1+json"
+}
+
+output "app_is_signed" {
+  value = length(data.docker_registry_referrers.signatures.referrers) > 0
+}
@@ -0,0 +1,11 @@
+data "docker_registry_image" "app" {
+  name = "registry.example.com/app:1.0"
+}
+
+data "docker_registry_stats" "calls" {
+  depends_on = [data.docker_registry_image.app]
+}
+
+output "registry_requests" {
+  value = data.docker_registry_stats.calls.requests
+}
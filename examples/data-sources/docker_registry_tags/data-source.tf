@@ -0,0 +1,22 @@
+data "docker_registry_tags" "alpine" {
+  name = "alpine"
+}
+
+output "alpine_tags" {
+  value = data.docker_registry_tags.alpine.tags
+}
+
+# all release tags referring to the same image as latest
+data "docker_registry_image" "app" {
+  name = "registry.example.com/app:latest"
+}
+
+data "docker_registry_tags" "app" {
+  name      = "registry.example.com/app"
+  tag_regex = "^v[0-9]+\\."
+  digest    = data.docker_registry_image.app.sha256_digest
+}
+
+output "app_latest_tags" {
+  value = data.docker_registry_tags.app.digest_tags
+}
@@ -0,0 +1,4 @@
+# Deletes the manifest the tag points to from the registry on destroy
+resource "docker_registry_manifest" "preview" {
+  name = "registry.example.com/app:pr-42"
+}
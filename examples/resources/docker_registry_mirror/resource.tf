@@ -0,0 +1,5 @@
+# Keeps a copy of the image in a backup registry, all platforms of a manifest list are copied
+resource "docker_registry_mirror" "app" {
+  source      = "registry.example.com/app:1.0"
+  destination = "backup.example.com/app:1.0"
+}
@@ -0,0 +1,5 @@
+# The plan shows a change of current_digest if the tag is moved to another image
+resource "docker_registry_pin" "app" {
+  name   = "registry.example.com/app:1.0"
+  digest = "sha256:8be990ef2aeb16dbcb9271ddfe2610fa6658d13f6dfb8bc72074cc1ca36966a7"
+}
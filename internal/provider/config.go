@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
 
+	"github.com/docker/cli/cli/config/configfile"
 	"github.com/docker/cli/cli/connhelper"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
@@ -81,6 +83,67 @@ func defaultPooledTransport() *http.Transport {
 	return transport
 }
 
+// newRegistryHTTPClient returns an http.Client for requests against registries. The shared http.DefaultClient
+// must not be used, as the TLS settings differ between data sources and resources. Transports are shared
+// by all clients with the same TLS settings, so the clients must not close their idle connections.
+// insecureSkipVerify takes precedence over the CA certificates configured for registries.
+func newRegistryHTTPClient(providerConfig *ProviderConfig, insecureSkipVerify bool) *http.Client {
+	key := registryTransportKey{insecureSkipVerify: insecureSkipVerify}
+	transport := providerConfig.RegistryTransports.get(key, func() *http.Transport {
+		return newRegistryTransport(providerConfig, key)
+	})
+	if hosts := providerConfig.ntlmHosts(); len(hosts) > 0 {
+		return &http.Client{Transport: registryNTLMTransport{hosts: hosts, transport: transport}, Timeout: providerConfig.RegistryTimeout, CheckRedirect: checkRegistryRedirect}
+	}
+	return &http.Client{Transport: transport, Timeout: providerConfig.RegistryTimeout, CheckRedirect: checkRegistryRedirect}
+}
+
+// Same as the limit of the default redirect policy of http.Client
+const registryMaxRedirects = 10
+
+// checkRegistryRedirect sends the Authorization header of the original request along redirects to the same host only.
+// Registries backed by a CDN or object storage redirect blobs and manifests to other hosts, which must not receive
+// the credentials and often reject requests carrying an Authorization header of their own anyway.
+func checkRegistryRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= registryMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", registryMaxRedirects)
+	}
+
+	original := via[0]
+	if req.URL.Host != original.URL.Host {
+		req.Header.Del("Authorization")
+		return nil
+	}
+	if authorization := original.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return nil
+}
+
+// buildRegistryCertPool returns the system cert pool extended by the given PEM encoded CA certificates.
+// nil is returned if no certificates are given, so that Go uses the system pool by itself.
+func buildRegistryCertPool(caPEMCerts ...[]byte) (*x509.CertPool, error) {
+	var pool *x509.CertPool
+	for _, caPEMCert := range caPEMCerts {
+		if len(caPEMCert) == 0 {
+			continue
+		}
+
+		if pool == nil {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil || systemPool == nil {
+				systemPool = x509.NewCertPool()
+			}
+			pool = systemPool
+		}
+
+		if !pool.AppendCertsFromPEM(caPEMCert) {
+			return nil, errors.New("No valid PEM encoded certificate found")
+		}
+	}
+	return pool, nil
+}
+
 // NewClient returns a new Docker client.
 func (c *Config) NewClient() (*client.Client, error) {
 	if c.Cert != "" || c.Key != "" {
@@ -147,6 +210,86 @@ type Data struct {
 type ProviderConfig struct {
 	DockerClient *client.Client
 	AuthConfigs  *AuthConfigs
+	// AWSProfile and AWSRegion are used to obtain tokens for ECR registries
+	AWSProfile string
+	AWSRegion  string
+	// GoogleCredentials is the service account key used for GCR and Artifact Registry, the application default credentials are used otherwise
+	GoogleCredentials string
+	// AzureTenantID, AzureClientID and AzureClientSecret identify the service principal used for ACR registries
+	AzureTenantID      string
+	AzureClientID      string
+	AzureClientSecret  string
+	AzureAuthorityHost string
+	// DefaultRegistry is the registry host of image names without a registry, Docker Hub if empty
+	DefaultRegistry string
+	// HubRegistry is the registry host serving Docker Hub images, dockerHubRegistry if empty
+	HubRegistry string
+	// DockerConfig is the Docker CLI config file the credential helpers are configured in, nil if none was loaded
+	DockerConfig *configfile.ConfigFile
+	// AuthStrategies are the strategies of registry hosts deviating from the distribution spec
+	AuthStrategies map[string]AuthStrategy
+	// RegistryRootCAs are the CAs trusted for registry requests, nil means the system pool
+	RegistryRootCAs *x509.CertPool
+	// RegistryClientCertificates are presented to registries requiring mutual TLS
+	RegistryClientCertificates []tls.Certificate
+	// RegistryMirrors maps registry hosts to the host, or base URL, of the mirror reads are sent to
+	RegistryMirrors map[string]string
+	// RegistryAPIPathPrefix is the path the registry API is served under, without a trailing slash, empty for the root
+	RegistryAPIPathPrefix string
+	// RegistryHeaders are added to registry and token requests unless the request sets them already
+	RegistryHeaders http.Header
+	// RegistryUserAgent is the User-Agent of registry and token requests, Go's default if empty
+	RegistryUserAgent string
+	// RegistryUnixSockets maps registry hosts to the Unix socket their connections are dialed on
+	RegistryUnixSockets map[string]string
+	// RegistryTLSOverrides maps registry hosts to the TLS settings deviating from the defaults, e.g. the SNI server name
+	RegistryTLSOverrides map[string]registryTLSOverride
+	// RegistryProxyURL overrides the proxy taken from the environment for registry requests
+	RegistryProxyURL *url.URL
+	// RegistryRequests limits the number of concurrent registry operations of all reads
+	RegistryRequests *registryRequestLimiter
+	// RegistryTransports shares the connections to registries across reads
+	RegistryTransports *registryTransportCache
+	// RegistryTokens caches the bearer tokens of registry token servers across reads
+	RegistryTokens *registryTokenCache
+	// RegistryDigests caches the digests tags were resolved to by the data sources, nil disables the cache
+	RegistryDigests *registryDigestCache
+	// RegistryStats counts the registry calls for the docker_registry_stats data source
+	RegistryStats *registryStats
+	// RegistryMaxRetries and RegistryRetryDelay control the retries of registry requests on 429 and 5xx responses
+	RegistryMaxRetries int
+	RegistryRetryDelay time.Duration
+	// RegistryMaxResponseSize limits the size of manifests, image configs, tag lists and token responses read
+	// from registries, 0 means defaultRegistryMaxResponseSize
+	RegistryMaxResponseSize int64
+	// RegistryTimeout limits the duration of a single registry request, 0 means no timeout
+	RegistryTimeout time.Duration
+	// RegistryTLSMinVersion is the minimum TLS version of registry connections, 0 means TLS 1.2
+	RegistryTLSMinVersion uint16
+}
+
+// registryURL returns the base URL for requests against the registry, or its mirror if one is configured.
+// Plain HTTP is only used if the host is configured with an http:// address in registry_auth, HTTPS otherwise.
+func registryURL(registry string, providerConfig *ProviderConfig) string {
+	if mirror, ok := providerConfig.RegistryMirrors[registry]; ok {
+		// DevSkim: ignore DS137138
+		if strings.HasPrefix(mirror, "https://") || strings.HasPrefix(mirror, "http://") {
+			return strings.TrimSuffix(mirror, "/")
+		}
+		registry = mirror
+	}
+	return registryAuthAddress(registry, providerConfig) + providerConfig.RegistryAPIPathPrefix
+}
+
+// registryAuthAddress returns the address the credentials of the registry are looked up with in the auth configs.
+// Mirrors are not taken into account, the credentials of the mirrored registry are sent to the mirror.
+func registryAuthAddress(registry string, providerConfig *ProviderConfig) string {
+	// DevSkim: ignore DS137138
+	httpURL := "http://" + registry
+	if _, ok := providerConfig.AuthConfigs.lookup(httpURL); ok {
+		return httpURL
+	}
+	return "https://" + registry
 }
 
 // The registry address can be referenced in various places (registry auth, docker config file, image name)
@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDockerImageReference() *schema.Resource {
+	return &schema.Resource{
+		Description: "Parses an image reference into the registry, repository, tag and digest the registry data sources read, without contacting the registry. Images without a registry are placed on the `default_registry` of the provider, or Docker Hub, and official Docker Hub images under `library/`, like `docker_registry_image` does.",
+
+		ReadContext: dataSourceDockerImageReferenceRead,
+
+		Schema: map[string]*schema.Schema{
+			"reference": {
+				Type:        schema.TypeString,
+				Description: "The image reference to parse, e.g. `alpine:3.16`, `ghcr.io/owner/app@sha256:...` or `docker://alpine`.",
+				Required:    true,
+			},
+
+			"registry": {
+				Type:        schema.TypeString,
+				Description: "The host of the registry the image is read from, e.g. `registry-1.docker.io` for Docker Hub images.",
+				Computed:    true,
+			},
+
+			"repository": {
+				Type:        schema.TypeString,
+				Description: "The repository of the image on the registry, e.g. `library/alpine` for the official Docker Hub image `alpine`.",
+				Computed:    true,
+			},
+
+			"tag": {
+				Type:        schema.TypeString,
+				Description: "The tag of the image, `latest` if neither a tag nor a digest is given. Empty if the image is only referenced by digest.",
+				Computed:    true,
+			},
+
+			"digest": {
+				Type:        schema.TypeString,
+				Description: "The digest the image is pinned to, e.g. `sha256:...`. Empty if the image is referenced by tag.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceDockerImageReferenceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	pullOpts := normalizeImageRef(d.Get("reference").(string), providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+
+	d.SetId(pullOpts.Registry + "/" + pullOpts.Repository + ":" + pullOpts.Tag + "@" + pullOpts.Digest)
+	d.Set("registry", pullOpts.Registry)
+	d.Set("repository", pullOpts.Repository)
+	d.Set("tag", pullOpts.Tag)
+	d.Set("digest", pullOpts.Digest)
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceDockerImageReferenceRead(t *testing.T) {
+	cases := []struct {
+		reference string
+		expected  map[string]string
+	}{
+		{"alpine", map[string]string{"registry": "registry-1.docker.io", "repository": "library/alpine", "tag": "latest", "digest": ""}},
+		{"docker://hashicorp/consul:1.12", map[string]string{"registry": "registry-1.docker.io", "repository": "hashicorp/consul", "tag": "1.12", "digest": ""}},
+		{"ghcr.io/owner/app@sha256:abc", map[string]string{"registry": "ghcr.io", "repository": "owner/app", "tag": "", "digest": "sha256:abc"}},
+		{"user:secret@localhost:5000/app:1.0", map[string]string{"registry": "localhost:5000", "repository": "app", "tag": "1.0", "digest": ""}},
+	}
+
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, dataSourceDockerImageReference().Schema, map[string]interface{}{"reference": c.reference})
+		if diags := dataSourceDockerImageReferenceRead(context.Background(), d, &ProviderConfig{}); diags.HasError() {
+			t.Fatalf("Unexpected error for '%s': %v", c.reference, diags)
+		}
+		for attribute, expected := range c.expected {
+			if value := d.Get(attribute).(string); value != expected {
+				t.Errorf("Expected %s '%s' for '%s', but got '%s'", attribute, expected, c.reference, value)
+			}
+		}
+	}
+
+	// the image is placed on the default registry of the provider like the registry data sources do
+	d := schema.TestResourceDataRaw(t, dataSourceDockerImageReference().Schema, map[string]interface{}{"reference": "team/app"})
+	dataSourceDockerImageReferenceRead(context.Background(), d, &ProviderConfig{DefaultRegistry: "registry.example.com"})
+	if registry := d.Get("registry").(string); registry != "registry.example.com" {
+		t.Errorf("Expected the default registry, but got %s", registry)
+	}
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDockerRegistries() *schema.Resource {
+	return &schema.Resource{
+		Description: "Lists the registries the provider has auth configs for, merged from `registry_auth` and the Docker CLI config file, e.g. to check the provider configuration. No credentials are exposed, only whether they are set.",
+
+		ReadContext: dataSourceDockerRegistriesRead,
+
+		Schema: map[string]*schema.Schema{
+			"registries": {
+				Type:        schema.TypeList,
+				Description: "The registries with an auth config, sorted by address.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"address": {
+							Type:        schema.TypeString,
+							Description: "The address of the auth config, e.g. `https://registry.example.com`",
+							Computed:    true,
+						},
+						"host": {
+							Type:        schema.TypeString,
+							Description: "The host of the registry, e.g. `registry.example.com`",
+							Computed:    true,
+						},
+						"has_credentials": {
+							Type:        schema.TypeBool,
+							Description: "`true` if a user name and password, an identity token or a registry token are set.",
+							Computed:    true,
+						},
+						"credential_helper": {
+							Type:        schema.TypeString,
+							Description: "The credential helper configured for the registry with `credHelpers` or `credsStore` in the Docker CLI config file. Empty if there is none.",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceDockerRegistriesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+
+	configs := map[string]types.AuthConfig{}
+	if providerConfig.AuthConfigs != nil {
+		configs = providerConfig.AuthConfigs.Configs
+	}
+
+	addresses := make([]string, 0, len(configs))
+	for address := range configs {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	registries := make([]interface{}, 0, len(addresses))
+	for _, address := range addresses {
+		auth := configs[address]
+		host := convertToHostname(address)
+		registries = append(registries, map[string]interface{}{
+			"address":           address,
+			"host":              host,
+			"has_credentials":   (auth.Username != "" && auth.Password != "") || auth.IdentityToken != "" || auth.RegistryToken != "",
+			"credential_helper": configuredCredentialHelper(providerConfig.DockerConfig, host),
+		})
+	}
+
+	d.SetId(strconv.Itoa(schema.HashString(strings.Join(addresses, ","))))
+	d.Set("registries", registries)
+
+	return nil
+}
+
+// configuredCredentialHelper returns the name of the credential helper the Docker CLI would ask for the credentials of host
+func configuredCredentialHelper(dockerConfig *configfile.ConfigFile, host string) string {
+	if dockerConfig == nil {
+		return ""
+	}
+	if helper, ok := dockerConfig.CredentialHelpers[host]; ok {
+		return helper
+	}
+	return dockerConfig.CredentialsStore
+}
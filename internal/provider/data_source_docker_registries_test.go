@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceDockerRegistriesRead(t *testing.T) {
+	providerConfig := &ProviderConfig{
+		AuthConfigs: &AuthConfigs{Configs: map[string]types.AuthConfig{
+			"https://registry.example.com": {Username: "user", Password: "secret"},
+			"https://ghcr.io":              {IdentityToken: "token"},
+			"http://insecure.example.com":  {},
+		}},
+		DockerConfig: &configfile.ConfigFile{
+			CredentialHelpers: map[string]string{"ghcr.io": "gh"},
+			CredentialsStore:  "desktop",
+		},
+	}
+
+	d := schema.TestResourceDataRaw(t, dataSourceDockerRegistries().Schema, map[string]interface{}{})
+	if diags := dataSourceDockerRegistriesRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Unexpected error: %v", diags)
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{"address": "http://insecure.example.com", "host": "insecure.example.com", "has_credentials": false, "credential_helper": "desktop"},
+		map[string]interface{}{"address": "https://ghcr.io", "host": "ghcr.io", "has_credentials": true, "credential_helper": "gh"},
+		map[string]interface{}{"address": "https://registry.example.com", "host": "registry.example.com", "has_credentials": true, "credential_helper": "desktop"},
+	}
+	if registries := d.Get("registries"); !reflect.DeepEqual(registries, expected) {
+		t.Errorf("Expected registries %v, but got %v", expected, registries)
+	}
+	if d.Id() == "" {
+		t.Error("Expected an id to be set")
+	}
+}
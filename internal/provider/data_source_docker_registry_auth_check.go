@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDockerRegistryAuthCheck() *schema.Resource {
+	return &schema.Resource{
+		Description: "Checks the credentials of a Docker Registry with a single request against the `/v2/` endpoint of the registry, e.g. to get fast feedback on misconfigured credentials before reading many images. Rejected credentials are not an error, but reported in `authenticated`.",
+
+		ReadContext: dataSourceDockerRegistryAuthCheckRead,
+
+		Schema: map[string]*schema.Schema{
+			"registry": {
+				Type:        schema.TypeString,
+				Description: "The address of the registry, e.g. `ghcr.io` or `registry.example.com:5000`. `docker.io` checks Docker Hub.",
+				Required:    true,
+			},
+
+			"scope": {
+				Type:        schema.TypeString,
+				Description: "The scope to request a token for, e.g. `repository:owner/app:pull`. Registries usually challenge `/v2/` without a scope, so the credentials are only checked for the registry as a whole by default.",
+				Optional:    true,
+			},
+
+			"username": {
+				Type:         schema.TypeString,
+				Description:  "The user name to check instead of the credentials configured in the provider for the registry.",
+				Optional:     true,
+				RequiredWith: []string{"password"},
+			},
+
+			"password": {
+				Type:         schema.TypeString,
+				Description:  "The password to check, along with `username`.",
+				Optional:     true,
+				Sensitive:    true,
+				RequiredWith: []string{"username"},
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"authenticated": {
+				Type:        schema.TypeBool,
+				Description: "`true` if the registry accepted the credentials, or allows anonymous access if no credentials are configured for it.",
+				Computed:    true,
+			},
+
+			"message": {
+				Type:        schema.TypeString,
+				Description: "The reason the registry rejected the credentials. Empty if `authenticated` is `true`.",
+				Computed:    true,
+			},
+
+			"granted_scope": {
+				Type:        schema.TypeString,
+				Description: "The scope of the token issued by the token server, or the requested scope if the token server does not return it. Empty if the registry did not challenge for a token.",
+				Computed:    true,
+			},
+
+			"token_expires_in": {
+				Type:        schema.TypeInt,
+				Description: "The lifetime of the issued token in seconds. `0` if the registry did not challenge for a token.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// registryAuthCheck is the outcome of probing the /v2/ endpoint of a registry with credentials
+type registryAuthCheck struct {
+	Authenticated  bool
+	Message        string
+	GrantedScope   string
+	TokenExpiresIn int
+}
+
+func dataSourceDockerRegistryAuthCheckRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	registry := registryAuthModeHost(d.Get("registry").(string))
+
+	username := d.Get("username").(string)
+	password := d.Get("password").(string)
+	if username == "" {
+		var err error
+		username, password, err = getRegistryCredentials(ctx, registry, providerConfig)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	check, err := checkRegistryAuth(ctx, registry, d.Get("scope").(string), username, password, d.Get("insecure_skip_verify").(bool), providerConfig)
+	if err != nil {
+		return diag.Errorf("Got error when attempting to check the credentials of registry %s: %s", registry, err)
+	}
+
+	d.SetId(registry)
+	d.Set("authenticated", check.Authenticated)
+	d.Set("message", check.Message)
+	d.Set("granted_scope", check.GrantedScope)
+	d.Set("token_expires_in", check.TokenExpiresIn)
+
+	return nil
+}
+
+// checkRegistryAuth requests /v2/ with the credentials and answers a bearer challenge the way doRegistryRequest does.
+// The token cache is bypassed, so that the credentials are exchanged for a token even if a valid one is cached.
+// Rejected credentials are reported in the result, errors are only returned if the registry could not be checked.
+func checkRegistryAuth(ctx context.Context, registry, scope, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) (*registryAuthCheck, error) {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(registry, providerConfig)+"/v2/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+
+	setRegistryHeaders(req, providerConfig)
+	strategy := providerConfig.authStrategy(registry, username)
+	strategy.Authorize(req, username, password)
+
+	resp, err := doLoggedRegistryRequest(ctx, client, req, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return nil, newRegistryResponseError("Got bad response from registry: ", resp)
+	}
+	resp.Body.Close()
+
+	check := &registryAuthCheck{}
+	if resp.StatusCode == http.StatusOK {
+		check.Authenticated = true
+		return check, nil
+	}
+	if !strings.HasPrefix(resp.Header.Get("www-authenticate"), "Bearer") {
+		check.Message = "Bad credentials: " + resp.Status
+		return check, nil
+	}
+
+	auth, err := parseAuthHeader(resp.Header.Get("www-authenticate"))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the authentication challenge of the registry: %s", err)
+	}
+	if scope != "" {
+		auth["scope"] = scope
+	}
+
+	token, err := strategy.Token(req.Context(), client, auth, username, password, providerConfig)
+	if err != nil {
+		check.Message = err.Error()
+		return check, nil
+	}
+	check.GrantedScope = token.Scope
+	if check.GrantedScope == "" {
+		check.GrantedScope = auth["scope"]
+	}
+	check.TokenExpiresIn = token.ExpiresIn
+	if check.TokenExpiresIn <= 0 {
+		check.TokenExpiresIn = defaultRegistryTokenExpiresIn
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.bearerToken())
+	authenticatedResponse, err := doLoggedRegistryRequest(ctx, client, req, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	switch authenticatedResponse.StatusCode {
+	case http.StatusOK:
+		authenticatedResponse.Body.Close()
+		check.Authenticated = true
+	case http.StatusUnauthorized, http.StatusForbidden:
+		check.Message = "The registry rejected the token: " + newRegistryResponseError("", authenticatedResponse).Error()
+	default:
+		return nil, newRegistryResponseError("Got bad response from registry: ", authenticatedResponse)
+	}
+
+	return check, nil
+}
+
+// The /v2/ endpoint is expected to answer quickly, a registry taking longer is considered unreachable by the probe
+const registryProbeTimeout = 5 * time.Second
+
+// registryProbeError is returned by probeRegistry if the registry is unreachable or rejects the credentials
+type registryProbeError struct {
+	registry    string
+	unreachable bool
+	message     string
+}
+
+func (e *registryProbeError) Error() string {
+	return e.message
+}
+
+func (e *registryProbeError) summary() string {
+	if e.unreachable {
+		return fmt.Sprintf("The registry %s is unreachable", e.registry)
+	}
+	return fmt.Sprintf("The registry %s rejected the credentials", e.registry)
+}
+
+// probeRegistry requests /v2/ once with a short timeout to check that the registry is reachable. The credentials
+// are only checked if the registry challenges for them, anonymous access is left to the following requests.
+func probeRegistry(ctx context.Context, registry, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, registryProbeTimeout)
+	defer cancel()
+
+	resp, err := sendRegistryProbe(ctx, registry, insecureSkipVerify, providerConfig)
+	if err != nil {
+		return &registryProbeError{registry: registry, unreachable: true, message: err.Error()}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized && username != "":
+		check, err := checkRegistryAuth(ctx, registry, "", username, password, insecureSkipVerify, providerConfig)
+		if err != nil {
+			return &registryProbeError{registry: registry, unreachable: true, message: err.Error()}
+		}
+		if !check.Authenticated {
+			return &registryProbeError{registry: registry, message: check.Message}
+		}
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized:
+		return &registryProbeError{registry: registry, unreachable: true, message: "Got bad response from registry: " + resp.Status}
+	}
+
+	return nil
+}
+
+// sendRegistryProbe requests /v2/ without credentials. The slot of the request limiter is released before the
+// credentials are checked, which takes a slot itself.
+func sendRegistryProbe(ctx context.Context, registry string, insecureSkipVerify bool, providerConfig *ProviderConfig) (*http.Response, error) {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(registry, providerConfig)+"/v2/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+	setRegistryHeaders(req, providerConfig)
+
+	resp, err := doLoggedRegistryRequest(ctx, client, req, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceDockerRegistryAuthCheckRead(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if username, password, _ := r.BasicAuth(); username != "user" || password != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if scope := r.URL.Query().Get("scope"); scope != "repository:app:pull" {
+				t.Errorf("Expected the configured scope in the token request, but got %s", scope)
+			}
+			fmt.Fprint(w, `{"token":"valid","expires_in":300,"scope":"repository:app:pull"}`)
+			return
+		}
+		if r.URL.Path != "/v2/" {
+			t.Errorf("Expected only /v2/ to be probed, but got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{
+		AuthConfigs: &AuthConfigs{Configs: map[string]types.AuthConfig{
+			"https://" + registry: {ServerAddress: "https://" + registry, Username: "user", Password: "pass"},
+		}},
+	}
+	raw := map[string]interface{}{
+		"registry":             registry,
+		"scope":                "repository:app:pull",
+		"insecure_skip_verify": true,
+	}
+	d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryAuthCheck().Schema, raw)
+	if diags := dataSourceDockerRegistryAuthCheckRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if !d.Get("authenticated").(bool) {
+		t.Errorf("Expected the credentials to be accepted, but got %s", d.Get("message").(string))
+	}
+	if scope := d.Get("granted_scope").(string); scope != "repository:app:pull" {
+		t.Errorf("Expected the granted scope repository:app:pull, but got %s", scope)
+	}
+	if expiresIn := d.Get("token_expires_in").(int); expiresIn != 300 {
+		t.Errorf("Expected the token to expire in 300 seconds, but got %d", expiresIn)
+	}
+
+	raw["username"] = "user"
+	raw["password"] = "wrong"
+	d = schema.TestResourceDataRaw(t, dataSourceDockerRegistryAuthCheck().Schema, raw)
+	if diags := dataSourceDockerRegistryAuthCheckRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected rejected credentials not to be an error, but got %v", diags)
+	}
+	if d.Get("authenticated").(bool) || d.Get("message").(string) == "" {
+		t.Errorf("Expected the credentials to be rejected with a message, but got %t and %q", d.Get("authenticated").(bool), d.Get("message").(string))
+	}
+}
+
+func TestCheckRegistryAuth_anonymous(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	check, err := checkRegistryAuth(context.Background(), strings.TrimPrefix(server.URL, "https://"), "", "", "", true, &ProviderConfig{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if !check.Authenticated || check.GrantedScope != "" || check.TokenExpiresIn != 0 {
+		t.Errorf("Expected an anonymous registry to be accessible without a token, but got %+v", check)
+	}
+}
+
+func TestProbeRegistry_registryHeaders(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userAgent := r.Header.Get("User-Agent"); userAgent != "terraform-provider-docker/test" {
+			t.Errorf("Expected the User-Agent of the provider, but got %q for %s", userAgent, r.URL.Path)
+		}
+		// a gateway in front of the registry rejects requests without its API key
+		if r.Header.Get("X-Api-Key") != "gateway" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token":"foo"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	registryHeaders := make(http.Header)
+	registryHeaders.Set("X-Api-Key", "gateway")
+	providerConfig := &ProviderConfig{RegistryHeaders: registryHeaders, RegistryUserAgent: "terraform-provider-docker/test"}
+	if err := probeRegistry(context.Background(), registry, "user", "pass", true, providerConfig); err != nil {
+		t.Errorf("Expected the configured header to be sent with the probe and the credential check, but got %s", err)
+	}
+}
@@ -3,15 +3,23 @@ package provider
 import (
 	"context"
 	"crypto/sha256"
-	"crypto/tls"
+	"crypto/sha512"
 	b64 "encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -24,200 +32,1957 @@ func dataSourceDockerRegistryImage() *schema.Resource {
 
 		Schema: map[string]*schema.Schema{
 			"name": {
-				Type:        schema.TypeString,
-				Description: "The name of the Docker image, including any tags. e.g. `alpine:latest`",
-				Required:    true,
+				Type:         schema.TypeString,
+				Description:  "The name of the Docker image, including any tags or a digest. e.g. `alpine:latest` or `alpine@sha256:...`. An image referenced by digest is read as is, which verifies that it still exists. A `docker://` or `oci://` prefix, as used by skopeo, is ignored. Credentials may precede the registry host, e.g. `user:pass@registry.example.com/app`, with special characters percent-encoded. They are used instead of those configured in the provider, but are stored in the state as part of the name, so prefer `username` and `password`. Either `name` or `repository` has to be set.",
+				Optional:     true,
+				ExactlyOneOf: []string{"name", "repository"},
+			},
+
+			"registry": {
+				Type:             schema.TypeString,
+				Description:      "The host of the registry, e.g. `ghcr.io` or `registry.example.com:5000`, used with `repository` instead of parsing `name`. Defaults to the `default_registry` of the provider, or Docker Hub.",
+				Optional:         true,
+				ConflictsWith:    []string{"name"},
+				ValidateDiagFunc: validateStringMatchesPattern(`^[a-zA-Z0-9.-]+(:[0-9]+)?$`),
+			},
+
+			"repository": {
+				Type:             schema.TypeString,
+				Description:      "The repository of the image on the registry, e.g. `owner/app`. Official images on Docker Hub are read from `library/` like with `name`.",
+				Optional:         true,
+				ValidateDiagFunc: validateStringMatchesPattern(`^[a-z0-9]+([._/-]+[a-z0-9]+)*$`),
+			},
+
+			"tag": {
+				Type:             schema.TypeString,
+				Description:      "The tag of the image, used with `repository`. Defaults to `latest`",
+				Optional:         true,
+				ConflictsWith:    []string{"name"},
+				ValidateDiagFunc: validateStringMatchesPattern(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`),
 			},
 
 			"sha256_digest": {
 				Type:        schema.TypeString,
-				Description: "The content digest of the image, as stored in the registry.",
+				Description: "The content digest of the image, as stored in the registry. The digest of the image of `platform` if set, see `index_digest` for the digest of the manifest list.",
+				Computed:    true,
+			},
+
+			"digest_algorithm": {
+				Type:        schema.TypeString,
+				Description: "The algorithm of `sha256_digest`, e.g. `sha256`, or `sha512` for registries storing manifests under sha512 digests. Despite its name, `sha256_digest` holds the digest of the algorithm used by the registry. Empty if the image does not exist.",
+				Computed:    true,
+			},
+
+			"subject_digest": {
+				Type:        schema.TypeString,
+				Description: "The digest of the manifest the manifest of `sha256_digest` is attached to, as stated in its `subject` field, e.g. the image an attestation or signature belongs to. Taken from the manifest list if `platform` is not set. Empty if the manifest has no subject.",
+				Computed:    true,
+			},
+
+			"index_digest": {
+				Type:        schema.TypeString,
+				Description: "The content digest of the manifest list the name refers to, regardless of `platform`. Empty if the name refers to a single image. Use it rather than `sha256_digest` to pin a `docker_image` resource to a multi-platform image, so that Docker still pulls the image of the platform it runs on, and `sha256_digest` to inspect or deploy exactly the image of `platform`.",
+				Computed:    true,
+			},
+
+			"platform": {
+				Type:             schema.TypeString,
+				Description:      "The platform to resolve in case the image is a manifest list, in the form `os/architecture[/variant]`, e.g. `linux/arm64`. The digest of the matching image is returned in `sha256_digest`. The read fails if several images of the list match, e.g. because the variant is left out.",
+				Optional:         true,
+				ValidateDiagFunc: validateStringMatchesPattern(`^[^/]+/[^/]+(/[^/]+)?$`),
+			},
+
+			"architecture": {
+				Type:        schema.TypeString,
+				Description: "The CPU architecture the image is built for, as stated in the image config. Empty for manifest lists spanning multiple platforms.",
+				Computed:    true,
+			},
+
+			"os": {
+				Type:        schema.TypeString,
+				Description: "The operating system the image is built for, as stated in the image config. Empty for manifest lists spanning multiple platforms.",
+				Computed:    true,
+			},
+
+			"created": {
+				Type:        schema.TypeString,
+				Description: "The date and time the image was created as RFC3339 timestamp, as stated in the image config. Empty for schema 1 manifests, which do not reference an image config.",
+				Computed:    true,
+			},
+
+			"annotations": {
+				Type:        schema.TypeMap,
+				Description: "The annotations of the manifest `sha256_digest` refers to, e.g. `org.opencontainers.image.source` set by buildkit. Unlike labels, annotations are stored in the manifest rather than the image config, so a manifest list has annotations of its own. Empty if the manifest has no annotations.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"labels": {
+				Type:        schema.TypeMap,
+				Description: "The labels of the image as stated in the image config, e.g. `org.opencontainers.image.revision`. Empty if the image has no labels.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"manifests": {
+				Type:        schema.TypeList,
+				Description: "The images referenced by the manifest list the name refers to, one per platform. Empty if the name refers to a single image. Attestation manifests are included with the platform `unknown/unknown`.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"digest": {
+							Type:        schema.TypeString,
+							Description: "The digest of the image manifest.",
+							Computed:    true,
+						},
+						"os": {
+							Type:        schema.TypeString,
+							Description: "The operating system of the image.",
+							Computed:    true,
+						},
+						"architecture": {
+							Type:        schema.TypeString,
+							Description: "The CPU architecture of the image.",
+							Computed:    true,
+						},
+						"variant": {
+							Type:        schema.TypeString,
+							Description: "The variant of the CPU architecture, e.g. `v7` for `arm`. Empty if the image does not state a variant.",
+							Computed:    true,
+						},
+					},
+				},
+			},
+
+			"layers": {
+				Type:        schema.TypeList,
+				Description: "The layers of the image in the order they are applied, as stated in the manifest of the image selected by `platform` for manifest lists. Empty for schema 1 manifests and manifest lists without a single image.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"digest": {
+							Type:        schema.TypeString,
+							Description: "The digest of the layer blob.",
+							Computed:    true,
+						},
+						"media_type": {
+							Type:        schema.TypeString,
+							Description: "The media type of the layer, e.g. `application/vnd.oci.image.layer.v1.tar+gzip`.",
+							Computed:    true,
+						},
+						"size": {
+							Type:        schema.TypeInt,
+							Description: "The size of the layer blob in bytes.",
+							Computed:    true,
+						},
+						"foreign": {
+							Type:        schema.TypeBool,
+							Description: "`true` for foreign or non-distributable layers, e.g. the base layers of Windows images, which are downloaded from `urls` instead of the registry.",
+							Computed:    true,
+						},
+						"urls": {
+							Type:        schema.TypeList,
+							Description: "The URLs the layer can be downloaded from if it is not stored in the registry.",
+							Computed:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+
+			"exposed_ports": {
+				Type:        schema.TypeSet,
+				Description: "The ports exposed by the image as stated in the image config, e.g. `8080/tcp`.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"entrypoint": {
+				Type:        schema.TypeList,
+				Description: "The entrypoint of the image as stated in the image config.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"cmd": {
+				Type:        schema.TypeList,
+				Description: "The default command of the image as stated in the image config.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"env": {
+				Type:        schema.TypeList,
+				Description: "The environment variables of the image in the form `KEY=value`, as stated in the image config.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"working_dir": {
+				Type:        schema.TypeString,
+				Description: "The working directory of the image as stated in the image config.",
+				Computed:    true,
+			},
+
+			"volumes": {
+				Type:        schema.TypeSet,
+				Description: "The volumes declared by the image as stated in the image config, e.g. `/data`.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"history": {
+				Type:        schema.TypeList,
+				Description: "The build history of the image as stated in the image config, oldest step first, e.g. to audit the commands the layers were created by. Steps which did not create a layer, like `ENV`, are included with `empty_layer` set. Empty if the image config has no history.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"created": {
+							Type:        schema.TypeString,
+							Description: "The date and time of the step in RFC 3339 format. Empty if not recorded.",
+							Computed:    true,
+						},
+						"created_by": {
+							Type:        schema.TypeString,
+							Description: "The command of the step, e.g. `/bin/sh -c apk add curl` or `RUN /bin/sh -c apk add curl # buildkit`.",
+							Computed:    true,
+						},
+						"empty_layer": {
+							Type:        schema.TypeBool,
+							Description: "`true` if the step did not create a layer.",
+							Computed:    true,
+						},
+					},
+				},
+			},
+
+			"media_type": {
+				Type:        schema.TypeString,
+				Description: "The media type of the manifest the name refers to, e.g. `application/vnd.oci.image.index.v1+json` for an OCI index or `application/vnd.docker.distribution.manifest.v2+json` for a single image. Not affected by `platform`.",
+				Computed:    true,
+			},
+
+			"is_manifest_list": {
+				Type:        schema.TypeBool,
+				Description: "`true` if `media_type` is a Docker manifest list or an OCI index, i.e. the name refers to a multi-platform image. Not affected by `platform`.",
+				Computed:    true,
+			},
+
+			"schema_version": {
+				Type:             schema.TypeInt,
+				Description:      "The schema version of the manifest the name refers to. `1` if the registry only returned a schema 1 manifest, e.g. older gcr.io versions, `2` otherwise. If set, only manifests of this schema version are requested, `1` with the schema 1 `Accept` header and `2` with the schema 2 and OCI ones, without falling back to the other version. Reading fails if the registry returns a manifest of the other version.",
+				Optional:         true,
+				Computed:         true,
+				ValidateDiagFunc: validateIntegerIsOneOf(1, 2),
+				ConflictsWith:    []string{"accept_media_types"},
+			},
+
+			"size_bytes": {
+				Type:        schema.TypeInt,
+				Description: "The size of the image in bytes, i.e. the sum of the sizes of the image config and all layers as stated in the manifest. For manifest lists the size of the image selected by `platform` is returned, `0` if no single image can be selected.",
+				Computed:    true,
+			},
+
+			"config_digest": {
+				Type:        schema.TypeString,
+				Description: "The digest of the image config, i.e. the image ID shown by `docker images`. Taken from the manifest of the image selected by `platform` for manifest lists. Empty for schema 1 manifests and manifest lists without a single image.",
+				Computed:    true,
+			},
+
+			"artifact_type": {
+				Type:        schema.TypeString,
+				Description: "The type of the artifact stored in the manifest, i.e. the `artifactType` of the manifest or the media type of its config, e.g. `application/vnd.cncf.helm.config.v1+json` for Helm charts or `application/vnd.oci.image.config.v1+json` for images.",
+				Computed:    true,
+			},
+
+			"ratelimit_limit": {
+				Type:        schema.TypeString,
+				Description: "The number of manifest requests allowed in the current rate limit window, as reported by the `RateLimit-Limit` header, e.g. by Docker Hub. Empty if the registry does not send the header.",
+				Computed:    true,
+			},
+
+			"ratelimit_remaining": {
+				Type:        schema.TypeString,
+				Description: "The number of manifest requests remaining in the current rate limit window, as reported by the `RateLimit-Remaining` header. Empty if the registry does not send the header.",
+				Computed:    true,
+			},
+
+			"granted_scope": {
+				Type:        schema.TypeString,
+				Description: "The scope the token server granted for resolving the digest, e.g. `repository:owner/app:pull`, to confirm that the credentials have access to the repository. Taken from the token response, or the access claim of the token if it is a JWT. Empty if the image was read anonymously, without a token exchange or the scope cannot be told.",
+				Computed:    true,
+			},
+
+			"token_expires_in": {
+				Type:        schema.TypeInt,
+				Description: "The lifetime in seconds of the bearer token used for resolving the digest, as returned by the token server. `0` if the image was read anonymously, without a token exchange or the token server did not return it.",
 				Computed:    true,
 			},
 
-			"insecure_skip_verify": {
-				Type:        schema.TypeBool,
-				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
-				Optional:    true,
-				Default:     false,
-			},
-		},
+			"accept_media_types": {
+				Type:        schema.TypeList,
+				Description: "The media types the manifest is requested with when resolving the digest, replacing the default `Accept` headers, e.g. only the OCI media types for registries rejecting the Docker ones. The schema 1 fallback is disabled if set.",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"username": {
+				Type:         schema.TypeString,
+				Description:  "The user name to authenticate with instead of the credentials configured in the provider for the registry, e.g. to read from another account on the same registry.",
+				Optional:     true,
+				RequiredWith: []string{"password"},
+			},
+
+			"password": {
+				Type:         schema.TypeString,
+				Description:  "The password to authenticate with, along with `username`.",
+				Optional:     true,
+				Sensitive:    true,
+				RequiredWith: []string{"username"},
+			},
+
+			"probe": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the `/v2/` endpoint of the registry is requested with a short timeout before the image is resolved, and the credentials are checked if the registry challenges for them. An unreachable registry or rejected credentials are then reported as such instead of as an error reading the image. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"fail_if_missing": {
+				Type:        schema.TypeBool,
+				Description: "If `false`, a tag or digest which does not exist in the registry is not an error. `exists` is set to `false` and `sha256_digest` is left empty instead. Defaults to `true`",
+				Optional:    true,
+				Default:     true,
+			},
+
+			"exists": {
+				Type:        schema.TypeBool,
+				Description: "`true` if the image exists in the registry. Can only be `false` if `fail_if_missing` is `false`.",
+				Computed:    true,
+			},
+
+			"pinned_reference": {
+				Type:        schema.TypeString,
+				Description: "The fully qualified name of the image pinned to `sha256_digest`, including the registry host and the `library/` prefix of official Docker Hub images, e.g. `docker.io/library/alpine@sha256:...`. It can be used as `name` of a `docker_image` resource to deploy exactly the image read.",
+				Computed:    true,
+			},
+
+			"cosign_public_key": {
+				Type:             schema.TypeString,
+				Description:      "A PEM encoded public key, e.g. `cosign.pub` written by `cosign generate-key-pair`. If set, the read fails unless the digest `name` resolves to is signed with this key by `cosign sign`. The signatures are read from the `sha256-<digest>.sig` tag cosign stores them in, the transparency log is not checked. For multi-platform images the manifest list is verified.",
+				Optional:         true,
+				ValidateDiagFunc: validateStringIsPublicKeyPEM(),
+			},
+
+			"resolve_tag": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the tags of the repository are searched for a more specific tag of the same image, e.g. `1.2.3` for `1.2`, which is returned in `resolved_tag`. This lists the tags and reads the digest of up to 20 candidate tags, so it is disabled by default. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"tag_must_be_semver": {
+				Type:          schema.TypeBool,
+				Description:   "If `true`, `name` or `repository` only names the repository, and the image of the tag with the highest semantic version is read, e.g. `1.4.2` or `v1.4.2`, which is returned in `resolved_tag`. Tags which are no semantic version with major, minor and patch version, e.g. `latest` or `1.4`, are ignored, as are pre-releases like `1.5.0-rc.1` unless `semver_constraint` names one. The read fails if no tag qualifies. Defaults to `false`",
+				Optional:      true,
+				Default:       false,
+				ConflictsWith: []string{"resolve_tag", "tag"},
+			},
+
+			"semver_constraint": {
+				Type:             schema.TypeString,
+				Description:      "A version constraint the tag picked with `tag_must_be_semver` has to satisfy, in the syntax of Terraform version constraints, e.g. `>= 1.2, < 2.0` or `~> 1.4`.",
+				Optional:         true,
+				RequiredWith:     []string{"tag_must_be_semver"},
+				ValidateDiagFunc: validateStringIsVersionConstraint(),
+			},
+
+			"resolved_tag": {
+				Type:        schema.TypeString,
+				Description: "The most specific tag referring to the same image as the tag of `name`, if `resolve_tag` is `true`, or the tag with the highest semantic version, if `tag_must_be_semver` is `true`. Empty if the registry does not allow listing tags or no such tag is found.",
+				Computed:    true,
+			},
+
+			"warn_mutable_tag": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, a warning is emitted if `name` references the `latest` tag, explicitly or implicitly, which is moved by every push. Use `pinned_reference` to deploy the resolved digest instead. Defaults to `true`",
+				Optional:    true,
+				Default:     true,
+			},
+		},
+	}
+}
+
+func dataSourceDockerRegistryImageRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	pullOpts, refAttribute := registryImageRef(d, providerConfig)
+
+	// credentials of the data source take precedence over the ones configured in the provider
+	username := d.Get("username").(string)
+	password := d.Get("password").(string)
+	if username == "" {
+		var err error
+		username, password, err = getImageRefCredentials(ctx, pullOpts, providerConfig)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	insecureSkipVerify := d.Get("insecure_skip_verify").(bool)
+	semverTag := ""
+	if d.Get("tag_must_be_semver").(bool) {
+		// only the default tag is filled in if name has none
+		if pullOpts.Digest != "" || pullOpts.Tag != "latest" {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("The image %s has to be given without a tag or digest if tag_must_be_semver is set", pullOpts.Repository),
+				Detail:        "The tag is picked from the tags of the repository, remove the tag or digest from the image, or unset tag_must_be_semver.",
+				AttributePath: cty.GetAttrPath(refAttribute),
+			}}
+		}
+		var constraints version.Constraints
+		if constraint := d.Get("semver_constraint").(string); constraint != "" {
+			// the constraint is validated at plan time
+			constraints, _ = version.NewConstraint(constraint)
+		}
+		tag, err := resolveLatestSemverTag(ctx, pullOpts.Registry, pullOpts.Repository, username, password, insecureSkipVerify, constraints, providerConfig)
+		if err != nil {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Unable to pick the semantic version tag of %s", pullOpts.Repository),
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("tag_must_be_semver"),
+			}}
+		}
+		semverTag = tag
+		pullOpts.Tag = tag
+	}
+
+	// A digest reference is fetched as is, which verifies that the pinned image still exists
+	imageName := pullOpts.imageName()
+	var diags diag.Diagnostics
+	if d.Get("warn_mutable_tag").(bool) && isMutableImageRef(pullOpts) {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Warning,
+			Summary:       fmt.Sprintf("The image %s references the mutable tag %s", imageName, pullOpts.Tag),
+			Detail:        "The tag is moved by every push, so the image read may change between runs. Pin the image by its digest, e.g. with the pinned_reference attribute, or set warn_mutable_tag to false to suppress this warning.",
+			AttributePath: cty.GetAttrPath(refAttribute),
+		})
+	}
+
+	acceptMediaTypes := stringListToStringSlice(d.Get("accept_media_types").([]interface{}))
+	schemaVersion := d.Get("schema_version").(int)
+	if schemaVersion != 0 {
+		acceptMediaTypes = manifestAcceptMediaTypes(schemaVersion == 1)
+	}
+	cacheKey := registryDigestCacheKey(pullOpts.Registry, pullOpts.Repository, pullOpts.reference(), username, password, insecureSkipVerify, acceptMediaTypes)
+	cached := true
+	result, fallback, err := providerConfig.RegistryDigests.get(cacheKey, func() (*imageDigestResult, bool, error) {
+		cached = false
+		if d.Get("probe").(bool) {
+			if err := probeRegistry(ctx, pullOpts.Registry, username, password, insecureSkipVerify, providerConfig); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if len(acceptMediaTypes) > 0 {
+			// the media types are requested as configured, without falling back to schema 1
+			result, err := getImageDigestAccepting(ctx, pullOpts.Registry, pullOpts.Repository, pullOpts.reference(), username, password, insecureSkipVerify, acceptMediaTypes, providerConfig)
+			return result, schemaVersion == 1, err
+		}
+
+		result, err := getImageDigest(ctx, pullOpts.Registry, pullOpts.Repository, pullOpts.reference(), username, password, insecureSkipVerify, false, providerConfig)
+		if shouldFallbackToSchema1(err) {
+			result, err = getImageDigest(ctx, pullOpts.Registry, pullOpts.Repository, pullOpts.reference(), username, password, insecureSkipVerify, true, providerConfig)
+			return result, true, err
+		}
+		return result, false, err
+	})
+	if cached && err == nil {
+		providerConfig.RegistryStats.countDigestCacheHit()
+	}
+	if isManifestNotFound(err) && !d.Get("fail_if_missing").(bool) {
+		d.SetId(pullOpts.Registry + "/" + imageName)
+		clearRegistryImageAttributes(d)
+		d.Set("exists", false)
+		return diags
+	}
+	var probeErr *registryProbeError
+	switch {
+	case errors.As(err, &probeErr):
+		return append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       probeErr.summary(),
+			Detail:        probeErr.Error(),
+			AttributePath: cty.GetAttrPath("probe"),
+		})
+	case isManifestUnknown(err):
+		return append(diags, registryErrorDiagnostics(fmt.Sprintf("The image %s was not found in the registry, the tag or digest does not exist", imageName), imageName, pullOpts.Registry, err)...)
+	case isRepositoryUnknown(err):
+		return append(diags, registryErrorDiagnostics(fmt.Sprintf("The image %s was not found in the registry, the repository does not exist", imageName), imageName, pullOpts.Registry, err)...)
+	case isRegistryUnauthorized(err):
+		return append(diags, registryErrorDiagnostics(fmt.Sprintf("The registry rejected the credentials for image %s, they are missing or invalid", imageName), imageName, pullOpts.Registry, err)...)
+	case isRegistryDenied(err):
+		return append(diags, registryErrorDiagnostics(fmt.Sprintf("The registry denied access to image %s, the credentials are valid but have no pull access to the repository", imageName), imageName, pullOpts.Registry, err)...)
+	case err != nil:
+		return append(diags, registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to fetch image version %s from registry", imageName), imageName, pullOpts.Registry, err)...)
+	}
+	if schemaVersion != 0 && manifestSchemaVersion(result.MediaType, fallback) != schemaVersion {
+		return append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("The registry returned a schema %d manifest for image %s instead of the requested schema %d", manifestSchemaVersion(result.MediaType, fallback), imageName, schemaVersion),
+			Detail:        fmt.Sprintf("The registry does not serve the image as schema %d manifest, it returned the media type %s. Remove schema_version to read the manifest the registry serves.", schemaVersion, result.MediaType),
+			AttributePath: cty.GetAttrPath("schema_version"),
+		})
+	}
+	digest := result.Digest
+	if publicKey := d.Get("cosign_public_key").(string); publicKey != "" {
+		// the key is validated at plan time
+		key, _ := parseCosignPublicKey(publicKey)
+		if err := verifyCosignSignature(ctx, pullOpts.Registry, pullOpts.Repository, digest, username, password, insecureSkipVerify, key, providerConfig); err != nil {
+			return append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("The image %s is not signed with the cosign public key", imageName),
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath("cosign_public_key"),
+			})
+		}
+	}
+	d.Set("exists", true)
+
+	platform := d.Get("platform").(string)
+	var manifestList *registryManifest
+	var manifest *registryManifest
+	var manifestErr error
+	if platform != "" || isManifestListMediaType(result.MediaType) {
+		manifestList, err = getResolvedImageManifest(ctx, pullOpts.Registry, pullOpts.Repository, result, username, password, insecureSkipVerify, providerConfig)
+		if err != nil {
+			return append(diags, registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to read the manifest list of image %s", imageName), imageName, pullOpts.Registry, err)...)
+		}
+		if !isManifestListMediaType(manifestList.MediaType) {
+			manifest, manifestList = manifestList, nil
+		}
+	} else {
+		manifest, manifestErr = getResolvedImageManifest(ctx, pullOpts.Registry, pullOpts.Repository, result, username, password, insecureSkipVerify, providerConfig)
+	}
+
+	// the attributes of a single image are only read if it is clear which image of the list is meant
+	imageDigest := ""
+	if platform != "" && manifestList != nil {
+		platformManifest, err := selectPlatformManifest(manifestList, platform)
+		if err != nil {
+			return append(diags, registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to resolve platform %s of image %s", platform, imageName), imageName, pullOpts.Registry, err)...)
+		}
+		digest = platformManifest.Digest
+		imageDigest = digest
+	} else if manifestList != nil {
+		imageDigest, _ = singlePlatformDigest(manifestList)
+	}
+	if imageDigest != "" {
+		client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+		manifest, manifestErr = getImageManifest(ctx, client, pullOpts.Registry, pullOpts.Repository, imageDigest, username, password, providerConfig)
+	}
+
+	d.SetId(digest)
+	d.Set("sha256_digest", digest)
+	d.Set("digest_algorithm", digestAlgorithm(digest))
+	d.Set("media_type", result.MediaType)
+	d.Set("is_manifest_list", isManifestListMediaType(result.MediaType))
+	indexDigest := ""
+	if isManifestListMediaType(result.MediaType) {
+		indexDigest = result.Digest
+	}
+	d.Set("index_digest", indexDigest)
+	d.Set("schema_version", manifestSchemaVersion(result.MediaType, fallback))
+	d.Set("ratelimit_limit", result.RateLimitLimit)
+	d.Set("ratelimit_remaining", result.RateLimitRemaining)
+	d.Set("granted_scope", result.GrantedScope)
+	d.Set("token_expires_in", result.TokenExpiresIn)
+	d.Set("manifests", flattenRegistryPlatformManifests(manifestList))
+	d.Set("pinned_reference", pinnedImageReference(pullOpts.Registry, pullOpts.Repository, digest))
+	resolvedTag := semverTag
+	if d.Get("resolve_tag").(bool) && pullOpts.Digest == "" {
+		resolvedTag = resolveRegistryTag(ctx, pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, result.Digest, username, password, insecureSkipVerify, fallback, providerConfig)
+	}
+	d.Set("resolved_tag", resolvedTag)
+
+	// a cancelled read fails instead of leaving the attributes of the image empty
+	if manifestErr != nil && ctx.Err() != nil {
+		return append(diags, registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to read the image manifest of %s", imageName), imageName, pullOpts.Registry, manifestErr)...)
+	}
+	if manifestErr != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Unable to read the image manifest of %s", imageName),
+			Detail:   manifestErr.Error(),
+		})
+	}
+	imageManifestRead := manifest != nil && manifestErr == nil
+	if !imageManifestRead {
+		manifest = &registryManifest{}
+	}
+	d.Set("size_bytes", manifest.imageSize())
+	d.Set("config_digest", manifest.Config.Digest)
+	d.Set("layers", flattenRegistryLayers(manifest.Layers))
+	artifactType := manifest.artifactType()
+	if manifestList != nil && manifestList.ArtifactType != "" {
+		artifactType = manifestList.ArtifactType
+	}
+	d.Set("artifact_type", artifactType)
+	annotations := manifest.Annotations
+	if manifestList != nil && platform == "" {
+		annotations = manifestList.Annotations
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	d.Set("annotations", annotations)
+	subject := manifest.Subject
+	if manifestList != nil && platform == "" {
+		subject = manifestList.Subject
+	}
+	subjectDigest := ""
+	if subject != nil {
+		subjectDigest = subject.Digest
+	}
+	d.Set("subject_digest", subjectDigest)
+
+	imageConfig := &registryImageConfig{}
+	if imageManifestRead && manifest.Config.Digest == "" {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("The manifest of %s does not reference an image config", imageName),
+			Detail:   "The attributes read from the image config, e.g. created, are left empty. This is the case for schema 1 manifests.",
+		})
+	}
+	// artifacts like Helm charts have a config which is not an image config
+	if manifest.Config.Digest != "" && isImageConfigMediaType(manifest.Config.MediaType) {
+		imageConfig, err = getImageConfig(ctx, pullOpts.Registry, pullOpts.Repository, manifest, username, password, insecureSkipVerify, providerConfig)
+		if err != nil && ctx.Err() != nil {
+			return append(diags, registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to read the image config of %s", imageName), imageName, pullOpts.Registry, err)...)
+		}
+		if err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Unable to read the image config of %s", imageName),
+				Detail:   err.Error(),
+			})
+			imageConfig = &registryImageConfig{}
+		}
+	}
+	d.Set("architecture", imageConfig.Architecture)
+	d.Set("os", imageConfig.OS)
+	created := ""
+	if imageConfig.Created != nil {
+		created = imageConfig.Created.UTC().Format(time.RFC3339)
+	}
+	d.Set("created", created)
+	labels := imageConfig.Config.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	d.Set("labels", labels)
+	d.Set("exposed_ports", registryConfigSetKeys(imageConfig.Config.ExposedPorts))
+	d.Set("entrypoint", imageConfig.Config.Entrypoint)
+	d.Set("cmd", imageConfig.Config.Cmd)
+	d.Set("env", imageConfig.Config.Env)
+	d.Set("working_dir", imageConfig.Config.WorkingDir)
+	d.Set("volumes", registryConfigSetKeys(imageConfig.Config.Volumes))
+	d.Set("history", flattenRegistryImageHistory(imageConfig.History))
+
+	return diags
+}
+
+func flattenRegistryPlatformManifests(manifestList *registryManifest) []interface{} {
+	if manifestList == nil {
+		return []interface{}{}
+	}
+
+	out := make([]interface{}, 0, len(manifestList.Manifests))
+	for _, m := range manifestList.Manifests {
+		out = append(out, map[string]interface{}{
+			"digest":       m.Digest,
+			"os":           m.Platform.OS,
+			"architecture": m.Platform.Architecture,
+			"variant":      m.Platform.Variant,
+		})
+	}
+	return out
+}
+
+// flattenRegistryImageHistory returns the history of the image config, timestamps are formatted like created
+func flattenRegistryImageHistory(history []registryImageHistory) []interface{} {
+	out := make([]interface{}, 0, len(history))
+	for _, step := range history {
+		created := ""
+		if step.Created != nil {
+			created = step.Created.UTC().Format(time.RFC3339)
+		}
+		out = append(out, map[string]interface{}{
+			"created":     created,
+			"created_by":  step.CreatedBy,
+			"empty_layer": step.EmptyLayer,
+		})
+	}
+	return out
+}
+
+// registryConfigSetKeys returns the keys of a set in the image config like ExposedPorts, which are encoded as objects with empty values
+func registryConfigSetKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dockerHubRegistry is the host serving the registry API of Docker Hub
+const dockerHubRegistry = "registry-1.docker.io"
+
+// dockerHubLibraryPrefix is the namespace of the official images on Docker Hub, e.g. library/alpine
+const dockerHubLibraryPrefix = "library/"
+
+// The header announcing the version of the registry API a client speaks, sent with manifest requests
+const (
+	registryAPIVersionHeader = "Docker-Distribution-Api-Version"
+	registryAPIVersion       = "registry/2.0"
+)
+
+// Hosts serving Docker Hub, the registry host is replaced by dockerHubRegistry
+var dockerHubHosts = map[string]bool{
+	"docker.io":               true,
+	"index.docker.io":         true,
+	"registry-1.docker.io":    true,
+	"registry.hub.docker.com": true,
+}
+
+// Public mirrors of Docker Hub, which serve official images under library/ like Docker Hub itself
+var dockerHubMirrorHosts = map[string]bool{
+	"mirror.gcr.io": true,
+}
+
+// normalizeImageRef splits the image name into the registry host, the repository path on that registry and the tag.
+// Images without a registry are read from the default registry, or Docker Hub if none is given. On Docker Hub
+// official images like 'consul' live under 'library/consul'. Docker Hub is served by hubRegistry if it is not empty.
+func normalizeImageRef(name, defaultRegistry, hubRegistry string) internalPullImageOptions {
+	pullOpts := parseImageOptions(name)
+	if pullOpts.Registry != "" {
+		// Filter the registry name out of the repo name
+		pullOpts.Repository = strings.Replace(pullOpts.Repository, pullOpts.Registry+"/", "", 1)
+	}
+
+	return normalizePullImageOptions(pullOpts, defaultRegistry, hubRegistry)
+}
+
+// normalizePullImageOptions fills in the registry and tag of image options given as separate parts, and moves
+// Docker Hub images to hubRegistry and the library/ namespace like normalizeImageRef
+func normalizePullImageOptions(pullOpts internalPullImageOptions, defaultRegistry, hubRegistry string) internalPullImageOptions {
+	if hubRegistry == "" {
+		hubRegistry = dockerHubRegistry
+	}
+
+	if pullOpts.Registry == "" {
+		pullOpts.Registry = hubRegistry
+		if defaultRegistry != "" {
+			pullOpts.Registry = defaultRegistry
+		}
+	}
+
+	if dockerHubHosts[pullOpts.Registry] {
+		pullOpts.Registry = hubRegistry
+	}
+
+	if pullOpts.Registry == hubRegistry || dockerHubMirrorHosts[pullOpts.Registry] {
+		if !strings.Contains(pullOpts.Repository, "/") {
+			pullOpts.Repository = dockerHubLibraryPrefix + pullOpts.Repository
+		}
+	}
+
+	if pullOpts.Tag == "" && pullOpts.Digest == "" {
+		pullOpts.Tag = "latest"
+	}
+
+	return pullOpts
+}
+
+// registryImageRef returns the image options of the data source, parsed from name or taken as is from registry,
+// repository and tag, and the attribute the tag was given in
+func registryImageRef(d *schema.ResourceData, providerConfig *ProviderConfig) (internalPullImageOptions, string) {
+	if name := d.Get("name").(string); name != "" {
+		return normalizeImageRef(name, providerConfig.DefaultRegistry, providerConfig.HubRegistry), "name"
+	}
+
+	pullOpts := internalPullImageOptions{
+		Registry:   d.Get("registry").(string),
+		Repository: d.Get("repository").(string),
+		Tag:        d.Get("tag").(string),
+	}
+	return normalizePullImageOptions(pullOpts, providerConfig.DefaultRegistry, providerConfig.HubRegistry), "tag"
+}
+
+// isMutableImageRef returns true if the image is referenced by the latest tag rather than a digest
+func isMutableImageRef(pullOpts internalPullImageOptions) bool {
+	return pullOpts.Digest == "" && pullOpts.Tag == "latest"
+}
+
+// pinnedImageReference returns the fully qualified name of the image pinned to the digest, as understood by the docker daemon
+func pinnedImageReference(registry, repository, digest string) string {
+	if registry == dockerHubRegistry {
+		registry = "docker.io"
+	}
+	return registry + "/" + repository + "@" + digest
+}
+
+// getRegistryCredentials returns the credentials configured for the registry in the provider, the Docker config file
+// or the environment, in this order.
+// For ECR and Google registries, and ACR registries if a service principal is configured, a token is obtained instead.
+func getRegistryCredentials(ctx context.Context, registry string, providerConfig *ProviderConfig) (string, string, error) {
+	username := ""
+	password := ""
+
+	if auth, ok := providerConfig.AuthConfigs.lookup(registryAuthAddress(registry, providerConfig)); ok {
+		username = auth.Username
+		password = auth.Password
+		if auth.IdentityToken != "" {
+			username = identityTokenUsername
+			password = auth.IdentityToken
+		}
+	}
+
+	if username == "" && providerConfig.DockerConfig != nil {
+		var err error
+		username, password, err = getCredentialHelperCredentials(providerConfig.DockerConfig, registry)
+		if err != nil {
+			return "", "", fmt.Errorf("Got error when attempting to obtain credentials for registry %s from the credential helper: %s", registry, err)
+		}
+	}
+
+	if username == "" {
+		var err error
+		username, password, err = getEnvRegistryCredentials(registry, providerConfig)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if username == "" && isECRRegistry(registry) {
+		var err error
+		username, password, err = getECRCredentials(ctx, registry, providerConfig.AWSProfile, providerConfig.AWSRegion)
+		if err != nil {
+			return "", "", fmt.Errorf("Got error when attempting to obtain an authorization token for ECR registry %s: %s", registry, err)
+		}
+	}
+
+	if username == "" && isGCRRegistry(registry) {
+		var err error
+		username, password, err = getGCRCredentials(ctx, providerConfig.GoogleCredentials)
+		if err != nil {
+			// without explicit credentials public images can still be read anonymously
+			if providerConfig.GoogleCredentials != "" {
+				return "", "", fmt.Errorf("Got error when attempting to obtain an access token for Google registry %s: %s", registry, err)
+			}
+			log.Printf("[DEBUG] No Google credentials found for %s, reading anonymously: %s", registry, err)
+			username, password = "", ""
+		}
+	}
+
+	if username == "" && isACRRegistry(registry) && providerConfig.AzureClientID != "" {
+		var err error
+		username, password, err = getACRCredentials(ctx, registry, providerConfig)
+		if err != nil {
+			return "", "", fmt.Errorf("Got error when attempting to obtain a refresh token for ACR registry %s: %s", registry, err)
+		}
+	}
+
+	return username, password, nil
+}
+
+// getImageRefCredentials returns the credentials embedded in the image reference, or those found for its registry otherwise
+func getImageRefCredentials(ctx context.Context, pullOpts internalPullImageOptions, providerConfig *ProviderConfig) (string, string, error) {
+	if pullOpts.Username != "" {
+		return pullOpts.Username, pullOpts.Password, nil
+	}
+	return getRegistryCredentials(ctx, pullOpts.Registry, providerConfig)
+}
+
+// imageDigestResult is the digest of a manifest along with the metadata the registry returned for it
+type imageDigestResult struct {
+	Digest             string
+	MediaType          string
+	RateLimitLimit     string
+	RateLimitRemaining string
+	// GrantedScope and TokenExpiresIn describe the bearer token of an authenticated request, if one was needed
+	GrantedScope   string
+	TokenExpiresIn int
+	// Body is the manifest Digest refers to, as downloaded along with the digest. Nil if it could not be read.
+	Body []byte
+}
+
+func getImageDigest(ctx context.Context, registry, image, tag, username, password string, insecureSkipVerify, fallback bool, providerConfig *ProviderConfig) (*imageDigestResult, error) {
+	return getImageDigestAccepting(ctx, registry, image, tag, username, password, insecureSkipVerify, manifestAcceptMediaTypes(fallback), providerConfig)
+}
+
+// clearRegistryImageAttributes resets all attributes read from the registry, none of them is left over from an
+// earlier read of an image which is missing now
+func clearRegistryImageAttributes(d *schema.ResourceData) {
+	for name, attribute := range dataSourceDockerRegistryImage().Schema {
+		if !attribute.Computed || attribute.Optional {
+			continue
+		}
+		switch attribute.Type {
+		case schema.TypeMap:
+			d.Set(name, map[string]interface{}{})
+		case schema.TypeList, schema.TypeSet:
+			d.Set(name, []interface{}{})
+		default:
+			d.Set(name, nil)
+		}
+	}
+}
+
+// getImageDigestAccepting resolves the digest of the tag, negotiating the manifest with the given media types
+func getImageDigestAccepting(ctx context.Context, registry, image, tag, username, password string, insecureSkipVerify bool, acceptMediaTypes []string, providerConfig *ProviderConfig) (*imageDigestResult, error) {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+
+	// the request carries the context for the logs of doRegistryRequest
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(registry, providerConfig)+"/v2/"+image+"/manifests/"+tag, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+
+	for _, mediaType := range acceptMediaTypes {
+		req.Header.Add("Accept", mediaType)
+	}
+	setRegistryAPIVersionHeader(req, providerConfig)
+	tflog.Trace(ctx, "Resolving the digest of the image", map[string]interface{}{
+		"registry": registry,
+		"image":    image,
+		"tag":      tag,
+		"accept":   strings.Join(acceptMediaTypes, ", "),
+	})
+
+	resp, grant, err := doRegistryRequestWithGrant(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, digest, mediaType, err := getManifestAndDigestFromResponse(resp, tag, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	tflog.Debug(ctx, "Resolved the digest of the image", map[string]interface{}{
+		"registry":   registry,
+		"image":      image,
+		"tag":        tag,
+		"digest":     digest,
+		"media_type": mediaType,
+	})
+
+	limit, remaining := getRateLimitFromResponse(resp)
+	result := &imageDigestResult{
+		Digest:             digest,
+		MediaType:          mediaType,
+		RateLimitLimit:     limit,
+		RateLimitRemaining: remaining,
+		Body:               body,
+	}
+	// anonymous tokens only grant public access, which tells nothing about the credentials
+	if grant != nil && username != "" {
+		result.GrantedScope = grant.scope
+		result.TokenExpiresIn = grant.expiresIn
+	}
+	return result, nil
+}
+
+// getResolvedImageManifest returns the manifest the digest was resolved to. The body downloaded along with the digest
+// is parsed, the manifest is only requested again if it could not be read then.
+func getResolvedImageManifest(ctx context.Context, registry, image string, result *imageDigestResult, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) (*registryManifest, error) {
+	if result.Body != nil {
+		return parseRegistryManifest(result.Body, result.MediaType)
+	}
+
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+	return getImageManifest(ctx, client, registry, image, result.Digest, username, password, providerConfig)
+}
+
+// singlePlatformDigest returns the digest of the only image of a manifest list, false if the list references several
+// platforms, in which case the `platform` attribute has to pick one
+func singlePlatformDigest(manifestList *registryManifest) (string, bool) {
+	var platformDigests []string
+	for _, m := range manifestList.Manifests {
+		// attestation manifests are stored next to the images with an unknown platform
+		if m.Platform.OS == "unknown" && m.Platform.Architecture == "unknown" {
+			continue
+		}
+		platformDigests = append(platformDigests, m.Digest)
+	}
+	if len(platformDigests) != 1 {
+		return "", false
+	}
+	return platformDigests[0], true
+}
+
+// getImageConfig fetches the image config blob referenced by the image manifest
+func getImageConfig(ctx context.Context, registry, image string, manifest *registryManifest, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) (*registryImageConfig, error) {
+	if manifest.Config.Digest == "" {
+		return nil, fmt.Errorf("The manifest does not reference an image config")
+	}
+
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(registry, providerConfig)+"/v2/"+image+"/blobs/"+manifest.Config.Digest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+
+	resp, err := doRegistryRequest(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readRegistryResponseBody(resp, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	imageConfig := &registryImageConfig{}
+	if err := json.Unmarshal(body, imageConfig); err != nil {
+		return nil, fmt.Errorf("Error parsing image config: %s", err)
+	}
+
+	return imageConfig, nil
+}
+
+// selectPlatformManifest finds the entry of the manifest list matching the platform given as os/architecture[/variant].
+// The variant is only compared if it is part of the platform.
+func selectPlatformManifest(manifest *registryManifest, platform string) (registryDescriptor, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return registryDescriptor{}, fmt.Errorf("Invalid platform %q, expected os/architecture[/variant]", platform)
+	}
+
+	available := make([]string, 0, len(manifest.Manifests))
+	var matches []registryDescriptor
+	for _, m := range manifest.Manifests {
+		if m.Platform.OS == parts[0] && m.Platform.Architecture == parts[1] && (len(parts) == 2 || m.Platform.Variant == parts[2]) {
+			matches = append(matches, m)
+		}
+		available = append(available, m.Platform.String())
+	}
+
+	switch len(matches) {
+	case 0:
+		return registryDescriptor{}, fmt.Errorf("No image found for platform %s, available platforms are: %s", platform, strings.Join(available, ", "))
+	case 1:
+		return matches[0], nil
+	}
+
+	ambiguous := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ambiguous = append(ambiguous, fmt.Sprintf("%s (%s)", m.Digest, m.Platform.String()))
+	}
+	return registryDescriptor{}, fmt.Errorf("Several images match platform %s, add the variant to pick one of: %s", platform, strings.Join(ambiguous, ", "))
+}
+
+func getImageManifest(ctx context.Context, client *http.Client, registry, image, reference, username, password string, providerConfig *ProviderConfig) (*registryManifest, error) {
+	rawManifest, err := getRawImageManifest(ctx, client, registry, image, reference, username, password, false, providerConfig)
+	if err != nil {
+		return nil, err
 	}
+
+	return parseRegistryManifest(rawManifest.Body, rawManifest.MediaType)
 }
 
-func dataSourceDockerRegistryImageRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	pullOpts := parseImageOptions(d.Get("name").(string))
-	authConfig := meta.(*ProviderConfig).AuthConfigs
+func parseRegistryManifest(body []byte, mediaType string) (*registryManifest, error) {
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest: %s", err)
+	}
 
-	// Use the official Docker Hub if a registry isn't specified
-	if pullOpts.Registry == "" {
-		pullOpts.Registry = "registry-1.docker.io"
-	} else {
-		// Otherwise, filter the registry name out of the repo name
-		pullOpts.Repository = strings.Replace(pullOpts.Repository, pullOpts.Registry+"/", "", 1)
+	// The media type is optional in the manifest body, the content type of the response is authoritative
+	if mediaType != "" {
+		manifest.MediaType = mediaType
 	}
 
-	if pullOpts.Registry == "registry-1.docker.io" {
-		// Docker prefixes 'library' to official images in the path; 'consul' becomes 'library/consul'
-		if !strings.Contains(pullOpts.Repository, "/") {
-			pullOpts.Repository = "library/" + pullOpts.Repository
-		}
+	return manifest, nil
+}
+
+// getRawImageManifest fetches the manifest document exactly as returned by the registry
+func getRawImageManifest(ctx context.Context, client *http.Client, registry, image, reference, username, password string, fallback bool, providerConfig *ProviderConfig) (*registryRawManifest, error) {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	if pullOpts.Tag == "" {
-		pullOpts.Tag = "latest"
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(registry, providerConfig)+"/v2/"+image+"/manifests/"+reference, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
 	}
 
-	username := ""
-	password := ""
+	setManifestAcceptHeaders(req, fallback)
+	setRegistryAPIVersionHeader(req, providerConfig)
 
-	if auth, ok := authConfig.Configs[normalizeRegistryAddress(pullOpts.Registry)]; ok {
-		username = auth.Username
-		password = auth.Password
+	resp, err := doRegistryRequest(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	insecureSkipVerify := d.Get("insecure_skip_verify").(bool)
-	digest, err := getImageDigest(pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, insecureSkipVerify, false)
+	body, err := readRegistryResponseBody(resp, providerConfig)
 	if err != nil {
-		digest, err = getImageDigest(pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, insecureSkipVerify, true)
-		if err != nil {
-			return diag.Errorf("Got error when attempting to fetch image version %s:%s from registry: %s", pullOpts.Repository, pullOpts.Tag, err)
-		}
+		return nil, err
 	}
 
-	d.SetId(digest)
-	d.Set("sha256_digest", digest)
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = manifestDigest(reference, body)
+	}
 
-	return nil
+	return &registryRawManifest{
+		Body:      body,
+		Digest:    digest,
+		MediaType: manifestMediaType(getMediaTypeFromResponse(resp), body),
+	}, nil
 }
 
-func getImageDigest(registry, image, tag, username, password string, insecureSkipVerify, fallback bool) (string, error) {
-	client := http.DefaultClient
-	// DevSkim: ignore DS440000
-	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipVerify}}
+// setRegistryAPIVersionHeader announces the registry API version like the Docker CLI does, some registry proxies
+// only answer manifest requests correctly with it. A value set in registry_headers takes precedence.
+func setRegistryAPIVersionHeader(req *http.Request, providerConfig *ProviderConfig) {
+	if _, ok := providerConfig.RegistryHeaders[registryAPIVersionHeader]; !ok {
+		req.Header.Set(registryAPIVersionHeader, registryAPIVersion)
+	}
+}
 
-	req, err := http.NewRequest("GET", "https://"+registry+"/v2/"+image+"/manifests/"+tag, nil)
-	if err != nil {
-		return "", fmt.Errorf("Error creating registry request: %s", err)
+func setManifestAcceptHeaders(req *http.Request, fallback bool) {
+	for _, mediaType := range manifestAcceptMediaTypes(fallback) {
+		req.Header.Add("Accept", mediaType)
 	}
+}
 
-	if username != "" {
-		if registry != "ghcr.io" {
-			req.SetBasicAuth(username, password)
-		} else {
-			req.Header.Add("Authorization", "Bearer "+b64.StdEncoding.EncodeToString([]byte(password)))
-		}
+// manifestAcceptMediaTypes returns the media types manifests are requested with by default
+func manifestAcceptMediaTypes(fallback bool) []string {
+	if fallback {
+		// Fallback to this header if the registry does not support the v2 manifest like gcr.io
+		return []string{"application/vnd.docker.distribution.manifest.v1+prettyjws"}
 	}
 
 	// We accept schema v2 manifests and manifest lists, and also OCI types
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.list.v2+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
+	return []string{
+		"application/vnd.docker.distribution.manifest.v2+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.oci.image.index.v1+json",
+		"application/vnd.oci.artifact.manifest.v1+json",
+	}
+}
 
-	if fallback {
-		// Fallback to this header if the registry does not support the v2 manifest like gcr.io
-		req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v1+prettyjws")
+// manifestSchemaVersion derives the schema version from the negotiated media type. Registries may serve
+// schema 1 manifests with a generic or no content type, which is only known to be schema 1 if it was requested.
+func manifestSchemaVersion(mediaType string, fallback bool) int {
+	switch mediaType {
+	case "application/vnd.docker.distribution.manifest.v1+json", "application/vnd.docker.distribution.manifest.v1+prettyjws":
+		return 1
+	case "application/json", "":
+		if fallback {
+			return 1
+		}
+	}
+	return 2
+}
+
+// isImageConfigMediaType returns true if the config of a manifest is an image config. Older manifests may omit the media type.
+func isImageConfigMediaType(mediaType string) bool {
+	switch mediaType {
+	case "", "application/vnd.docker.container.image.v1+json", "application/vnd.oci.image.config.v1+json":
+		return true
 	}
+	return false
+}
+
+func isManifestListMediaType(mediaType string) bool {
+	return mediaType == "application/vnd.docker.distribution.manifest.list.v2+json" || mediaType == "application/vnd.oci.image.index.v1+json"
+}
+
+// doRegistryRequest performs the request against the registry and answers an OAuth challenge if needed.
+// The returned response always has the status 200, every other status is turned into an error.
+func doRegistryRequest(client *http.Client, req *http.Request, registry, username, password string, providerConfig *ProviderConfig) (*http.Response, error) {
+	resp, _, err := doRegistryRequestWithGrant(client, req, registry, username, password, providerConfig)
+	return resp, err
+}
+
+// doRegistryRequestWithGrant is like doRegistryRequest, but returns the bearer token the request was answered with
+// as well, nil if no token exchange was needed
+func doRegistryRequestWithGrant(client *http.Client, req *http.Request, registry, username, password string, providerConfig *ProviderConfig) (*http.Response, *registryTokenGrant, error) {
+	ctx := req.Context()
+	setRegistryHeaders(req, providerConfig)
+	strategy := providerConfig.authStrategy(registry, username)
+	strategy.Authorize(req, username, password)
 
-	resp, err := client.Do(req)
+	resp, err := doLoggedRegistryRequest(ctx, client, req, providerConfig)
 	if err != nil {
-		return "", fmt.Errorf("Error during registry request: %s", err)
+		return nil, nil, err
 	}
 
 	switch resp.StatusCode {
-	// Basic auth was valid or not needed
-	case http.StatusOK:
-		return getDigestFromResponse(resp)
+	// Basic auth was valid or not needed, deletes and started uploads are answered with 202, completed uploads with 201
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+		return resp, nil, nil
 
 	// Either OAuth is required or the basic auth creds were invalid
 	case http.StatusUnauthorized:
 		if strings.HasPrefix(resp.Header.Get("www-authenticate"), "Bearer") {
-			auth := parseAuthHeader(resp.Header.Get("www-authenticate"))
-			params := url.Values{}
-			params.Set("service", auth["service"])
-			params.Set("scope", auth["scope"])
-			tokenRequest, err := http.NewRequest("GET", auth["realm"]+"?"+params.Encode(), nil)
+			resp.Body.Close()
+			auth, err := parseAuthHeader(resp.Header.Get("www-authenticate"))
 			if err != nil {
-				return "", fmt.Errorf("Error creating registry request: %s", err)
+				return nil, nil, fmt.Errorf("Error parsing the authentication challenge of the registry: %s", err)
 			}
-
-			if username != "" {
-				tokenRequest.SetBasicAuth(username, password)
+			// older registries, Artifactory and some proxies omit the scope, but reject tokens issued without one
+			if auth["scope"] == "" {
+				auth["scope"] = artifactoryTokenScope(auth["realm"], registryRequestScope(req))
 			}
-
-			tokenResponse, err := client.Do(tokenRequest)
+			key := registryTokenCacheKey(auth["realm"], auth["service"], auth["scope"], username, password)
+			cached := true
+			grant, err := providerConfig.RegistryTokens.getGrant(key, func() (*TokenResponse, error) {
+				cached = false
+				return getRegistryTokenWithStrategy(ctx, strategy, client, auth, registry, username, password, providerConfig)
+			})
+			if cached && err == nil {
+				providerConfig.RegistryStats.countTokenCacheHit()
+			}
+			logRegistryToken(ctx, auth, username, err)
 			if err != nil {
-				return "", fmt.Errorf("Error during registry request: %s", err)
+				return nil, nil, err
 			}
 
-			if tokenResponse.StatusCode != http.StatusOK {
-				return "", fmt.Errorf("Got bad response from registry: " + tokenResponse.Status)
+			req.Header.Set("Authorization", "Bearer "+grant.token)
+			if err := resetRegistryRequestBody(req); err != nil {
+				return nil, nil, err
 			}
-
-			body, err := ioutil.ReadAll(tokenResponse.Body)
+			authenticatedResponse, err := doLoggedRegistryRequest(ctx, client, req, providerConfig)
 			if err != nil {
-				return "", fmt.Errorf("Error reading response body: %s", err)
+				return nil, nil, err
 			}
 
-			token := &TokenResponse{}
-			err = json.Unmarshal(body, token)
-			if err != nil {
-				return "", fmt.Errorf("Error parsing OAuth token response: %s", err)
-			}
+			// the token may have been revoked or expired early during a long apply. A refresh token obtains a new one,
+			// otherwise the credentials are exchanged for a new token once before giving up.
+			if authenticatedResponse.StatusCode == http.StatusUnauthorized {
+				authenticatedResponse.Body.Close()
+				providerConfig.RegistryTokens.invalidate(key)
+				refreshToken := providerConfig.RegistryTokens.refreshToken(registry, username)
+				grant, err = providerConfig.RegistryTokens.getGrant(key, func() (*TokenResponse, error) {
+					if refreshToken != "" {
+						return getRegistryTokenWithStrategy(ctx, refreshTokenAuthStrategy{}, client, auth, registry, username, refreshToken, providerConfig)
+					}
+					return getRegistryTokenWithStrategy(ctx, strategy, client, auth, registry, username, password, providerConfig)
+				})
+				logRegistryToken(ctx, auth, username, err)
+				if err != nil {
+					return nil, nil, err
+				}
 
-			req.Header.Set("Authorization", "Bearer "+token.Token)
-			digestResponse, err := client.Do(req)
-			if err != nil {
-				return "", fmt.Errorf("Error during registry request: %s", err)
+				req.Header.Set("Authorization", "Bearer "+grant.token)
+				if err := resetRegistryRequestBody(req); err != nil {
+					return nil, nil, err
+				}
+				authenticatedResponse, err = doLoggedRegistryRequest(ctx, client, req, providerConfig)
+				if err != nil {
+					return nil, nil, err
+				}
 			}
 
-			if digestResponse.StatusCode != http.StatusOK {
-				return "", fmt.Errorf("Got bad response from registry: " + digestResponse.Status)
+			if authenticatedResponse.StatusCode != http.StatusOK && authenticatedResponse.StatusCode != http.StatusCreated && authenticatedResponse.StatusCode != http.StatusAccepted {
+				return nil, nil, newRegistryResponseError("Got bad response from registry: ", authenticatedResponse)
 			}
 
-			return getDigestFromResponse(digestResponse)
+			return authenticatedResponse, &grant, nil
 		}
 
-		return "", fmt.Errorf("Bad credentials: " + resp.Status)
+		return nil, nil, newRegistryResponseError("Bad credentials: ", resp)
 
 		// Some unexpected status was given, return an error
 	default:
-		return "", fmt.Errorf("Got bad response from registry: " + resp.Status)
+		return nil, nil, newRegistryResponseError("Got bad response from registry: ", resp)
+	}
+}
+
+// setRegistryHeaders adds the user_agent and registry_headers of the provider to the request. Headers the request has
+// already, e.g. the Accept headers of manifest requests, are kept, the Authorization header is overwritten by the auth strategy.
+func setRegistryHeaders(req *http.Request, providerConfig *ProviderConfig) {
+	if providerConfig.RegistryUserAgent != "" {
+		req.Header.Set("User-Agent", providerConfig.RegistryUserAgent)
+	}
+	for name, values := range providerConfig.RegistryHeaders {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+}
+
+// doLoggedRegistryRequest sends the request with retries and logs it without the credentials at debug level
+func doLoggedRegistryRequest(ctx context.Context, client *http.Client, req *http.Request, providerConfig *ProviderConfig) (*http.Response, error) {
+	fields := map[string]interface{}{
+		"method": req.Method,
+		"url":    redactRegistryURL(req.URL),
+		"auth":   registryAuthScheme(req.Header.Get("Authorization")),
+	}
+	tflog.Trace(ctx, "Sending registry request", fields)
+
+	resp, err := doRegistryRequestWithRetry(client, req, providerConfig)
+	if err != nil {
+		fields["error"] = err.Error()
+		tflog.Debug(ctx, "Registry request failed", fields)
+		return nil, err
+	}
+
+	fields["status"] = resp.StatusCode
+	fields["content_type"] = resp.Header.Get("Content-Type")
+	tflog.Debug(ctx, "Received registry response", fields)
+	return resp, nil
+}
+
+// logRegistryToken logs the outcome of a token exchange, the token itself is never logged
+func logRegistryToken(ctx context.Context, challenge map[string]string, username string, err error) {
+	fields := map[string]interface{}{
+		"realm":     challenge["realm"],
+		"service":   challenge["service"],
+		"scope":     challenge["scope"],
+		"anonymous": username == "",
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		tflog.Debug(ctx, "Unable to obtain a registry token", fields)
+		return
+	}
+	tflog.Debug(ctx, "Obtained a registry token", fields)
+}
+
+// registryAuthScheme returns the scheme of an Authorization header, e.g. Basic or Bearer, so that it can be logged
+func registryAuthScheme(authorization string) string {
+	if authorization == "" {
+		return "none"
+	}
+	return strings.SplitN(authorization, " ", 2)[0]
+}
+
+// Error codes of the distribution spec, returned in the body of error responses
+const (
+	registryErrorManifestUnknown = "MANIFEST_UNKNOWN"
+	registryErrorNameUnknown     = "NAME_UNKNOWN"
+	registryErrorUnauthorized    = "UNAUTHORIZED"
+	registryErrorDenied          = "DENIED"
+)
+
+// Manifests, image configs and token responses are read up to this size unless max_response_size is set
+const defaultRegistryMaxResponseSize = 4 * 1024 * 1024
+
+// Error bodies are only read up to this size, as they are not expected to be larger than a few errors
+const maxRegistryErrorBodySize = 64 * 1024
+
+// registryErrorDetail is an error of the errors array in the body of error responses
+type registryErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// registryResponseError is returned for responses of the registry with a status other than 200
+type registryResponseError struct {
+	StatusCode int
+	Status     string
+	// URL is the request URL without credentials
+	URL string
+	// Errors are parsed from the response body, empty if the registry did not send errors in the format of the distribution spec
+	Errors  []registryErrorDetail
+	message string
+}
+
+// newRegistryResponseError returns the error for the response, reading the errors from the body and closing it
+func newRegistryResponseError(message string, resp *http.Response) *registryResponseError {
+	err := &registryResponseError{StatusCode: resp.StatusCode, Status: resp.Status, message: message + resp.Status}
+	if resp.Request != nil {
+		err.URL = redactRegistryURL(resp.Request.URL)
+	}
+	if resp.Body != nil {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxRegistryErrorBodySize))
+		resp.Body.Close()
+
+		errorResponse := struct {
+			Errors []registryErrorDetail `json:"errors"`
+		}{}
+		// registries and proxies may answer with a body in another format, e.g. HTML, which is ignored
+		if json.Unmarshal(body, &errorResponse) == nil {
+			err.Errors = errorResponse.Errors
+		}
+	}
+	return err
+}
+
+func (e *registryResponseError) Error() string {
+	if len(e.Errors) == 0 {
+		return e.message
+	}
+
+	details := make([]string, 0, len(e.Errors))
+	for _, detail := range e.Errors {
+		details = append(details, detail.Code+": "+detail.Message)
+	}
+	return e.message + " (" + strings.Join(details, ", ") + ")"
+}
+
+// hasErrorCode returns true if the registry returned an error with the code in the response body
+func (e *registryResponseError) hasErrorCode(code string) bool {
+	for _, detail := range e.Errors {
+		if detail.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Query parameters which may carry credentials and are redacted from URLs in diagnostics and logs
+var sensitiveQueryParameters = []string{"access_token", "refresh_token", "token", "password", "client_secret"}
+
+// redactRegistryURL returns the URL without the password of the user info and with sensitive query parameters masked
+func redactRegistryURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redacted := *u
+	query := redacted.Query()
+	masked := false
+	for _, param := range sensitiveQueryParameters {
+		if query.Has(param) {
+			query.Set(param, "xxxxx")
+			masked = true
+		}
+	}
+	if masked {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.Redacted()
+}
+
+// redactImageRef returns the image reference with the password of embedded credentials masked like redactRegistryURL does
+func redactImageRef(image string) string {
+	scheme := ""
+	for _, prefix := range imageReferenceSchemes {
+		if strings.HasPrefix(image, prefix) {
+			scheme, image = prefix, image[len(prefix):]
+		}
+	}
+
+	userinfo, rest := splitImageUserinfo(image)
+	if userinfo == "" {
+		return scheme + image
+	}
+	if colon := strings.Index(userinfo, ":"); colon != -1 {
+		userinfo = userinfo[:colon] + ":xxxxx"
+	}
+	return scheme + userinfo + "@" + rest
+}
+
+// registryErrorDiagnostics describes a failed registry operation for an image, naming the registry and,
+// for error responses, the request URL and the HTTP status
+func registryErrorDiagnostics(summary, imageName, registry string, err error) diag.Diagnostics {
+	detail := fmt.Sprintf("Image: %s/%s\nRegistry: %s\n", registry, imageName, registry)
+	var responseErr *registryResponseError
+	if errors.As(err, &responseErr) {
+		if responseErr.URL != "" {
+			detail += fmt.Sprintf("URL: %s\n", responseErr.URL)
+		}
+		detail += fmt.Sprintf("Status: %s\n", responseErr.Status)
+	}
+	detail += "\n" + err.Error()
+
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  summary,
+		Detail:   detail,
+	}}
+}
+
+// shouldFallbackToSchema1 returns true if the manifest request failed in a way that a request with the
+// schema 1 Accept header might succeed. Failed authentication and transport errors are not retried.
+func shouldFallbackToSchema1(err error) bool {
+	var responseErr *registryResponseError
+	if !errors.As(err, &responseErr) {
+		return false
+	}
+
+	switch responseErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// isManifestNotFound returns true if the registry answered the manifest request with 404, i.e. the tag or digest does not exist
+func isManifestNotFound(err error) bool {
+	var responseErr *registryResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound
+}
+
+// isManifestUnknown returns true if the registry reported the tag or digest as unknown with the MANIFEST_UNKNOWN
+// error code, as opposed to a repository which does not exist or a 404 of a proxy in front of the registry
+func isManifestUnknown(err error) bool {
+	var responseErr *registryResponseError
+	return errors.As(err, &responseErr) && responseErr.hasErrorCode(registryErrorManifestUnknown)
+}
+
+// isRepositoryUnknown returns true if the registry reported the repository as unknown with the NAME_UNKNOWN error code
+func isRepositoryUnknown(err error) bool {
+	var responseErr *registryResponseError
+	return errors.As(err, &responseErr) && responseErr.hasErrorCode(registryErrorNameUnknown)
+}
+
+// isRegistryUnauthorized returns true if the registry rejected the credentials, or requires some, with the UNAUTHORIZED
+// error code or a 401 without error code
+func isRegistryUnauthorized(err error) bool {
+	var responseErr *registryResponseError
+	if !errors.As(err, &responseErr) || responseErr.hasErrorCode(registryErrorDenied) {
+		return false
+	}
+	return responseErr.hasErrorCode(registryErrorUnauthorized) || responseErr.StatusCode == http.StatusUnauthorized
+}
+
+// isRegistryDenied returns true if the registry accepted the credentials, but denied access to the repository with the
+// DENIED error code or a 403 without error code
+func isRegistryDenied(err error) bool {
+	var responseErr *registryResponseError
+	if !errors.As(err, &responseErr) || responseErr.hasErrorCode(registryErrorUnauthorized) {
+		return false
+	}
+	return responseErr.hasErrorCode(registryErrorDenied) || responseErr.StatusCode == http.StatusForbidden
+}
+
+// getRegistryTokenWithStrategy answers the challenge with the strategy and stores a refresh token issued along with the token
+func getRegistryTokenWithStrategy(ctx context.Context, strategy AuthStrategy, client *http.Client, auth map[string]string, registry, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	providerConfig.RegistryStats.countTokenExchange()
+	token, err := strategy.Token(ctx, client, auth, username, password, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" {
+		providerConfig.RegistryTokens.setRefreshToken(registry, username, token.RefreshToken)
+	}
+	return token, nil
+}
+
+// getRegistryToken requests a bearer token from the token server named in the parsed WWW-Authenticate challenge.
+// Authenticated requests ask for a refresh token as well, which token servers only return if they support offline access.
+func getRegistryToken(ctx context.Context, client *http.Client, auth map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	params := url.Values{}
+	params.Set("service", auth["service"])
+	// several scopes of a challenge are sent as separate parameters, token servers like Harbor's do not split them
+	for _, scope := range strings.Fields(auth["scope"]) {
+		params.Add("scope", scope)
+	}
+	if username != "" {
+		// the account is sent like the Docker CLI does, quay.io expects it to match the robot account, e.g. org+robot
+		params.Set("account", username)
+		params.Set("offline_token", "true")
+		params.Set("client_id", registryTokenClientID)
+	}
+	tokenRequest, err := http.NewRequestWithContext(ctx, "GET", auth["realm"]+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+
+	setRegistryHeaders(tokenRequest, providerConfig)
+	if username != "" {
+		tokenRequest.SetBasicAuth(username, password)
+	}
+
+	tokenResponse, err := doRegistryRequestWithRetry(client, tokenRequest, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer tokenResponse.Body.Close()
+
+	if tokenResponse.StatusCode != http.StatusOK {
+		return nil, newRegistryResponseError("Got bad response from registry: ", tokenResponse)
+	}
+
+	body, err := readRegistryResponseBody(tokenResponse, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &TokenResponse{}
+	err = json.Unmarshal(body, token)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing OAuth token response: %s", err)
 	}
+
+	return token, nil
 }
 
 type TokenResponse struct {
-	Token string
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+	// Scope is returned by OAuth2 token servers if the granted scope differs from the requested one
+	Scope string `json:"scope"`
+	// RefreshToken is returned if offline access was requested
+	RefreshToken string `json:"refresh_token"`
+}
+
+// registryDescriptor references content stored in the registry, e.g. an image config, a layer or a manifest
+type registryDescriptor struct {
+	MediaType    string           `json:"mediaType"`
+	ArtifactType string           `json:"artifactType"`
+	Digest       string           `json:"digest"`
+	Size         int64            `json:"size"`
+	Platform     registryPlatform `json:"platform"`
+	// URLs are set for foreign layers, which are not stored in the registry itself
+	URLs        []string          `json:"urls"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// isForeign returns true for layers which registries do not have to store, i.e. foreign Docker layers and non-distributable OCI layers
+func (d registryDescriptor) isForeign() bool {
+	return len(d.URLs) > 0 || strings.Contains(d.MediaType, ".foreign.") || strings.Contains(d.MediaType, ".nondistributable.")
+}
+
+type registryPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant"`
+}
+
+func (p registryPlatform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// registryManifest covers the fields we need from image manifests as well as manifest lists
+type registryManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	ArtifactType  string               `json:"artifactType"`
+	Config        registryDescriptor   `json:"config"`
+	Layers        []registryDescriptor `json:"layers"`
+	Manifests     []registryDescriptor `json:"manifests"`
+	Annotations   map[string]string    `json:"annotations"`
+	// Subject is set for manifests attached to another manifest, e.g. attestations and signatures
+	Subject *registryDescriptor `json:"subject"`
+}
+
+// artifactType returns the artifactType of the manifest, or the media type of the config for manifests
+// without one as described by the OCI image spec
+func (m *registryManifest) artifactType() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	return m.Config.MediaType
+}
+
+// imageSize sums the sizes of the config and the layers of an image manifest. Foreign layers are included as
+// they are downloaded on pull as well, only from a different location.
+func (m *registryManifest) imageSize() int64 {
+	size := m.Config.Size
+	for _, layer := range m.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// registryRawManifest is a manifest document along with the metadata of the response
+type registryRawManifest struct {
+	Body      []byte
+	Digest    string
+	MediaType string
+}
+
+// registryImageConfig is the image config blob referenced by a manifest
+type registryImageConfig struct {
+	Architecture string     `json:"architecture"`
+	OS           string     `json:"os"`
+	Created      *time.Time `json:"created"`
+	Config       struct {
+		Labels       map[string]string   `json:"Labels"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		Env          []string            `json:"Env"`
+		WorkingDir   string              `json:"WorkingDir"`
+		Volumes      map[string]struct{} `json:"Volumes"`
+	} `json:"config"`
+	History []registryImageHistory `json:"history"`
+}
+
+// registryImageHistory is a build step recorded in the image config
+type registryImageHistory struct {
+	Created    *time.Time `json:"created"`
+	CreatedBy  string     `json:"created_by"`
+	EmptyLayer bool       `json:"empty_layer"`
 }
 
-// Parses key/value pairs from a WWW-Authenticate header
-func parseAuthHeader(header string) map[string]string {
-	parts := strings.SplitN(header, " ", 2)
-	parts = strings.Split(parts[1], ",")
+// Parses key/value pairs from a WWW-Authenticate header, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"
+// Values may be quoted strings containing commas and escaped quotes. Keys are returned in lower case.
+func parseAuthHeader(header string) (map[string]string, error) {
+	header = strings.TrimSpace(header)
+	schemeEnd := strings.IndexAny(header, " \t")
+	if schemeEnd == -1 {
+		return nil, fmt.Errorf("no parameters in challenge '%s'", header)
+	}
+
+	params := header[schemeEnd+1:]
 	opts := make(map[string]string)
+	isSeparator := func(c byte) bool {
+		return c == ',' || c == ' ' || c == '\t'
+	}
+
+	for i := 0; i < len(params); {
+		if isSeparator(params[i]) {
+			i++
+			continue
+		}
+
+		keyStart := i
+		for i < len(params) && params[i] != '=' && !isSeparator(params[i]) {
+			i++
+		}
+		key := strings.ToLower(params[keyStart:i])
+		if i >= len(params) || params[i] != '=' {
+			return nil, fmt.Errorf("parameter '%s' has no value", key)
+		}
+		i++
+
+		var value strings.Builder
+		if i < len(params) && params[i] == '"' {
+			i++
+			closed := false
+			for ; i < len(params); i++ {
+				if params[i] == '\\' && i+1 < len(params) {
+					i++
+				} else if params[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				value.WriteByte(params[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted value of parameter '%s'", key)
+			}
+		} else {
+			for ; i < len(params) && !isSeparator(params[i]); i++ {
+				value.WriteByte(params[i])
+			}
+		}
+
+		opts[key] = value.String()
+	}
+
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("no parameters in challenge '%s'", header)
+	}
+
+	return opts, nil
+}
+
+// registryRequestScope returns the pull scope of the repository a read request targets, e.g. repository:owner/app:pull
+// for /v2/owner/app/manifests/latest. Empty for other requests, or requests not targeting a repository like /v2/.
+func registryRequestScope(req *http.Request) string {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return ""
+	}
+
+	// mirrors may be given as base URL with a path of their own
+	path := req.URL.Path
+	apiIndex := strings.Index(path, "/v2/")
+	if apiIndex == -1 {
+		return ""
+	}
+	path = path[apiIndex+len("/v2/"):]
 
-	for _, part := range parts {
-		vals := strings.SplitN(part, "=", 2)
-		key := vals[0]
-		val := strings.Trim(vals[1], "\", ")
-		opts[key] = val
+	for _, endpoint := range []string{"/manifests/", "/blobs/", "/tags/", "/referrers/"} {
+		if endpointIndex := strings.LastIndex(path, endpoint); endpointIndex > 0 {
+			return "repository:" + path[:endpointIndex] + ":pull"
+		}
 	}
+	return ""
+}
 
-	return opts
+// getDigestFromResponse returns the Docker-Content-Digest header and the media type of the manifest requested by
+// reference. Without the header the digest is computed over the body exactly as returned, which is the digest the
+// registry stores the manifest under and manifest lists reference, re-encoding the JSON would change it.
+func getDigestFromResponse(response *http.Response, reference string, providerConfig *ProviderConfig) (string, string, error) {
+	_, digest, mediaType, err := getManifestAndDigestFromResponse(response, reference, providerConfig)
+	return digest, mediaType, err
 }
 
-func getDigestFromResponse(response *http.Response) (string, error) {
+// getManifestAndDigestFromResponse is like getDigestFromResponse, but returns the manifest body as well. With a
+// Docker-Content-Digest header the body is optional, nil is returned if it could not be read.
+func getManifestAndDigestFromResponse(response *http.Response, reference string, providerConfig *ProviderConfig) ([]byte, string, string, error) {
 	header := response.Header.Get("Docker-Content-Digest")
+	mediaType := getMediaTypeFromResponse(response)
+	body, err := readRegistryResponseBody(response, providerConfig)
 
 	if header == "" {
-		body, err := ioutil.ReadAll(response.Body)
 		if err != nil {
-			return "", fmt.Errorf("Error reading registry response body: %s", err)
+			return nil, "", "", err
 		}
 
-		return fmt.Sprintf("sha256:%x", sha256.Sum256(body)), nil
+		return body, manifestDigest(reference, body), manifestMediaType(mediaType, body), nil
+	}
+
+	if err != nil {
+		body = nil
+	}
+	return body, header, mediaType, nil
+}
+
+// manifestMediaType returns the media type of a manifest, taken from the body if the registry sent no or only a
+// generic content type. OCI indexes without a mediaType field are recognized by their manifests.
+func manifestMediaType(contentType string, body []byte) string {
+	if contentType != "" && contentType != "application/json" && contentType != "text/plain" {
+		return contentType
+	}
+
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return contentType
+	}
+	switch {
+	case manifest.MediaType != "":
+		return manifest.MediaType
+	case manifest.SchemaVersion == 2 && len(manifest.Manifests) > 0:
+		return "application/vnd.oci.image.index.v1+json"
+	}
+	return contentType
+}
+
+// readRegistryResponseBody reads the body of a registry response up to the maximum response size of the provider,
+// larger bodies are an error instead of being read into memory
+func readRegistryResponseBody(response *http.Response, providerConfig *ProviderConfig) ([]byte, error) {
+	limit := providerConfig.RegistryMaxResponseSize
+	if limit <= 0 {
+		limit = defaultRegistryMaxResponseSize
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading registry response body: %s", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("The registry response is larger than max_response_size (%d bytes)", limit)
+	}
+	return body, nil
+}
+
+// manifestDigest computes the content digest of a manifest requested by reference. A manifest requested by a
+// sha512 digest is digested with sha512 like the registry stores it, any other with sha256. The digest of a
+// signed schema 1 manifest is computed over the payload without the signatures, like the registry does.
+func manifestDigest(reference string, body []byte) string {
+	if payload, ok := schema1SignedPayload(body); ok {
+		body = payload
+	}
+	if digestAlgorithm(reference) == "sha512" {
+		return fmt.Sprintf("sha512:%x", sha512.Sum512(body))
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+}
+
+// digestAlgorithm returns the algorithm of a digest, e.g. sha256 for sha256:..., or an empty string for a tag
+func digestAlgorithm(reference string) string {
+	if i := strings.Index(reference, ":"); i != -1 {
+		return reference[:i]
+	}
+	return ""
+}
+
+// schema1SignedPayload extracts the payload of a signed schema 1 manifest, i.e. a JWS in the pretty format
+// of libtrust. The protected header of a signature states the length of the formatted payload up to the
+// signatures and the base64 encoded tail following them.
+func schema1SignedPayload(body []byte) ([]byte, bool) {
+	manifest := struct {
+		Signatures []struct {
+			Protected string `json:"protected"`
+		} `json:"signatures"`
+	}{}
+	if err := json.Unmarshal(body, &manifest); err != nil || len(manifest.Signatures) == 0 {
+		return nil, false
+	}
+
+	protectedJSON, err := b64.RawURLEncoding.DecodeString(strings.TrimRight(manifest.Signatures[0].Protected, "="))
+	if err != nil {
+		return nil, false
+	}
+	protected := struct {
+		FormatLength int    `json:"formatLength"`
+		FormatTail   string `json:"formatTail"`
+	}{}
+	if err := json.Unmarshal(protectedJSON, &protected); err != nil {
+		return nil, false
+	}
+	tail, err := b64.RawURLEncoding.DecodeString(strings.TrimRight(protected.FormatTail, "="))
+	if err != nil || protected.FormatLength <= 0 || protected.FormatLength > len(body) {
+		return nil, false
+	}
+
+	payload := make([]byte, 0, protected.FormatLength+len(tail))
+	payload = append(payload, body[:protected.FormatLength]...)
+	return append(payload, tail...), true
+}
+
+// getMediaTypeFromResponse returns the media type of the Content-Type header without parameters like charset
+func getMediaTypeFromResponse(response *http.Response) string {
+	return strings.TrimSpace(strings.SplitN(response.Header.Get("Content-Type"), ";", 2)[0])
+}
+
+// getRateLimitFromResponse returns the quota values of the RateLimit-Limit and RateLimit-Remaining headers.
+// The quota policy following the value, like ';w=21600' on Docker Hub, is dropped.
+func getRateLimitFromResponse(response *http.Response) (string, string) {
+	quota := func(header string) string {
+		return strings.TrimSpace(strings.SplitN(response.Header.Get(header), ";", 2)[0])
 	}
 
-	return header, nil
+	return quota("RateLimit-Limit"), quota("RateLimit-Remaining")
 }
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDockerRegistryImageManifest() *schema.Resource {
+	return &schema.Resource{
+		Description: "Reads the manifest of an image from a Docker Registry, e.g. to inspect the layers or annotations of an image.",
+
+		ReadContext: dataSourceDockerRegistryImageManifestRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "The name of the Docker image, including any tags or a digest. e.g. `alpine:latest`",
+				Required:    true,
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"sha256_digest": {
+				Type:        schema.TypeString,
+				Description: "The content digest of the manifest, as stored in the registry.",
+				Computed:    true,
+			},
+
+			"media_type": {
+				Type:        schema.TypeString,
+				Description: "The media type of the manifest as returned by the registry.",
+				Computed:    true,
+			},
+
+			"manifest_json": {
+				Type:        schema.TypeString,
+				Description: "The manifest document exactly as returned by the registry. Use `jsondecode` to access fields not exposed as attributes.",
+				Computed:    true,
+			},
+
+			"schema_version": {
+				Type:        schema.TypeInt,
+				Description: "The `schemaVersion` of the manifest.",
+				Computed:    true,
+			},
+
+			"layers": {
+				Type:        schema.TypeList,
+				Description: "The layers of the image. Empty for manifest lists and schema 1 manifests.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"digest": {
+							Type:        schema.TypeString,
+							Description: "The digest of the layer blob.",
+							Computed:    true,
+						},
+						"media_type": {
+							Type:        schema.TypeString,
+							Description: "The media type of the layer.",
+							Computed:    true,
+						},
+						"size": {
+							Type:        schema.TypeInt,
+							Description: "The size of the layer blob in bytes.",
+							Computed:    true,
+						},
+						"foreign": {
+							Type:        schema.TypeBool,
+							Description: "`true` for foreign or non-distributable layers, which are downloaded from `urls` instead of the registry.",
+							Computed:    true,
+						},
+						"urls": {
+							Type:        schema.TypeList,
+							Description: "The URLs the layer can be downloaded from if it is not stored in the registry.",
+							Computed:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceDockerRegistryImageManifestRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	pullOpts := normalizeImageRef(d.Get("name").(string), providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+
+	username, password, err := getImageRefCredentials(ctx, pullOpts, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	client := newRegistryHTTPClient(providerConfig, d.Get("insecure_skip_verify").(bool))
+
+	rawManifest, err := getRawImageManifest(ctx, client, pullOpts.Registry, pullOpts.Repository, pullOpts.reference(), username, password, false, providerConfig)
+	if shouldFallbackToSchema1(err) {
+		rawManifest, err = getRawImageManifest(ctx, client, pullOpts.Registry, pullOpts.Repository, pullOpts.reference(), username, password, true, providerConfig)
+	}
+	if err != nil {
+		return registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to fetch the manifest of %s from registry", redactImageRef(d.Get("name").(string))), pullOpts.imageName(), pullOpts.Registry, err)
+	}
+
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(rawManifest.Body, manifest); err != nil {
+		return diag.Errorf("Error parsing manifest: %s", err)
+	}
+
+	d.SetId(rawManifest.Digest)
+	d.Set("sha256_digest", rawManifest.Digest)
+	d.Set("media_type", rawManifest.MediaType)
+	d.Set("manifest_json", string(rawManifest.Body))
+	d.Set("schema_version", manifest.SchemaVersion)
+	d.Set("layers", flattenRegistryLayers(manifest.Layers))
+
+	return nil
+}
+
+func flattenRegistryLayers(layers []registryDescriptor) []interface{} {
+	out := make([]interface{}, 0, len(layers))
+	for _, layer := range layers {
+		out = append(out, map[string]interface{}{
+			"digest":     layer.Digest,
+			"media_type": layer.MediaType,
+			"size":       int(layer.Size),
+			"foreign":    layer.isForeign(),
+			"urls":       layer.URLs,
+		})
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceDockerRegistryImageManifestRead(t *testing.T) {
+	manifestJSON := `{"schemaVersion":2,"config":{"digest":"sha256:config","size":100},"layers":[` +
+		`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:layer","size":1000}],` +
+		`"annotations":{"org.opencontainers.image.source":"https://example.com"}}`
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/app/manifests/1.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:manifest")
+		fmt.Fprint(w, manifestJSON)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryImageManifest().Schema, map[string]interface{}{
+		"name":                 registry + "/app:1.0",
+		"insecure_skip_verify": true,
+	})
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}}
+	if diags := dataSourceDockerRegistryImageManifestRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+
+	if d.Id() != "sha256:manifest" || d.Get("sha256_digest") != "sha256:manifest" {
+		t.Errorf("Expected digest sha256:manifest, but got %s", d.Get("sha256_digest"))
+	}
+	if d.Get("manifest_json") != manifestJSON {
+		t.Errorf("Expected the manifest as returned by the registry, but got %s", d.Get("manifest_json"))
+	}
+	if d.Get("schema_version") != 2 || d.Get("media_type") != "application/vnd.oci.image.manifest.v1+json" {
+		t.Errorf("Expected schema version 2 of an OCI manifest, but got %d of %s", d.Get("schema_version"), d.Get("media_type"))
+	}
+	if d.Get("layers.#") != 1 || d.Get("layers.0.digest") != "sha256:layer" || d.Get("layers.0.size") != 1000 {
+		t.Errorf("Expected a single layer sha256:layer, but got %v", d.Get("layers"))
+	}
+}
@@ -0,0 +1,225 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDockerRegistryReferrers() *schema.Resource {
+	return &schema.Resource{
+		Description: "Lists the referrers of an image in a Docker Registry, i.e. the signatures, SBOMs and attestations attached to it, e.g. to check that an image is signed with cosign.",
+
+		ReadContext: dataSourceDockerRegistryReferrersRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "The name of the Docker image, including any tags or a digest. e.g. `ghcr.io/owner/app:1.0`",
+				Required:    true,
+			},
+
+			"artifact_type": {
+				Type:        schema.TypeString,
+				Description: "Only list referrers of this artifact type, e.g. `application/vnd.dev.cosign.artifact.sig.v1+json`.",
+				Optional:    true,
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"sha256_digest": {
+				Type:        schema.TypeString,
+				Description: "The digest of the image the referrers refer to.",
+				Computed:    true,
+			},
+
+			"referrers": {
+				Type:        schema.TypeList,
+				Description: "The referrers of the image. Registries without the referrers API are queried with the tag schema of the OCI distribution spec, i.e. the `sha256-<digest>` tag.",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"digest": {
+							Type:        schema.TypeString,
+							Description: "The digest of the referrer manifest.",
+							Computed:    true,
+						},
+						"artifact_type": {
+							Type:        schema.TypeString,
+							Description: "The artifact type of the referrer.",
+							Computed:    true,
+						},
+						"media_type": {
+							Type:        schema.TypeString,
+							Description: "The media type of the referrer manifest.",
+							Computed:    true,
+						},
+						"size": {
+							Type:        schema.TypeInt,
+							Description: "The size of the referrer manifest in bytes.",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceDockerRegistryReferrersRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	pullOpts := normalizeImageRef(d.Get("name").(string), providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+
+	username, password, err := getImageRefCredentials(ctx, pullOpts, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	insecureSkipVerify := d.Get("insecure_skip_verify").(bool)
+	imageName := pullOpts.imageName()
+	digest := pullOpts.Digest
+	if digest == "" {
+		result, err := getImageDigest(ctx, pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, insecureSkipVerify, false, providerConfig)
+		if err != nil {
+			return registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to fetch image version %s from registry", imageName), imageName, pullOpts.Registry, err)
+		}
+		digest = result.Digest
+	}
+
+	artifactType := d.Get("artifact_type").(string)
+	referrers, err := getRegistryReferrers(ctx, pullOpts.Registry, pullOpts.Repository, digest, artifactType, username, password, insecureSkipVerify, providerConfig)
+	if err != nil {
+		return registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to list the referrers of %s", imageName), imageName, pullOpts.Registry, err)
+	}
+
+	d.SetId(digest)
+	d.Set("sha256_digest", digest)
+	d.Set("referrers", flattenRegistryReferrers(referrers))
+
+	return nil
+}
+
+// getRegistryReferrers lists the manifests referring to digest with the referrers API. Registries not supporting
+// the API answer with 404, the referrers are then read from the index tagged with the digest as the spec describes.
+func getRegistryReferrers(ctx context.Context, registry, image, digest, artifactType, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) ([]registryDescriptor, error) {
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+
+	referrersURL := registryURL(registry, providerConfig) + "/v2/" + image + "/referrers/" + digest
+	if artifactType != "" {
+		referrersURL += "?" + url.Values{"artifactType": []string{artifactType}}.Encode()
+	}
+
+	referrers := []registryDescriptor{}
+	for next := referrersURL; next != ""; {
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating registry request: %s", err)
+		}
+
+		page, link, err := getRegistryReferrersPage(client, req, registry, username, password, providerConfig)
+		if isManifestNotFound(err) && next == referrersURL {
+			return getRegistryReferrersFromTag(ctx, client, registry, image, digest, artifactType, username, password, providerConfig)
+		}
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, page...)
+
+		next = ""
+		if link != "" {
+			nextURL, err := resolveNextLink(req.URL, link, providerConfig)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing the link to the next page of referrers: %s", err)
+			}
+			next = nextURL.String()
+		}
+	}
+
+	// registries may ignore the filter, which is announced with the OCI-Filters-Applied header
+	return filterRegistryReferrers(referrers, artifactType), nil
+}
+
+// getRegistryReferrersPage returns the referrers of a single page and the possibly relative link to the next page
+func getRegistryReferrersPage(client *http.Client, req *http.Request, registry, username, password string, providerConfig *ProviderConfig) ([]registryDescriptor, string, error) {
+	release, err := providerConfig.RegistryRequests.acquire(req.Context())
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	req.Header.Set("Accept", "application/vnd.oci.image.index.v1+json")
+	resp, err := doRegistryRequest(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := readRegistryResponseBody(resp, providerConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	index := &registryManifest{}
+	if err := json.Unmarshal(body, index); err != nil {
+		return nil, "", fmt.Errorf("Error parsing referrers: %s", err)
+	}
+
+	return index.Manifests, parseNextLink(resp.Header.Get("Link")), nil
+}
+
+// getRegistryReferrersFromTag reads the referrers from the index tagged sha256-<hex>, a missing tag means there are no referrers
+func getRegistryReferrersFromTag(ctx context.Context, client *http.Client, registry, image, digest, artifactType, username, password string, providerConfig *ProviderConfig) ([]registryDescriptor, error) {
+	tag := strings.Replace(digest, ":", "-", 1)
+	rawManifest, err := getRawImageManifest(ctx, client, registry, image, tag, username, password, false, providerConfig)
+	if isManifestNotFound(err) {
+		return []registryDescriptor{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := &registryManifest{}
+	if err := json.Unmarshal(rawManifest.Body, index); err != nil {
+		return nil, fmt.Errorf("Error parsing referrers: %s", err)
+	}
+
+	return filterRegistryReferrers(index.Manifests, artifactType), nil
+}
+
+func filterRegistryReferrers(referrers []registryDescriptor, artifactType string) []registryDescriptor {
+	if artifactType == "" {
+		return referrers
+	}
+
+	filtered := []registryDescriptor{}
+	for _, referrer := range referrers {
+		if referrer.ArtifactType == artifactType {
+			filtered = append(filtered, referrer)
+		}
+	}
+	return filtered
+}
+
+func flattenRegistryReferrers(referrers []registryDescriptor) []interface{} {
+	out := make([]interface{}, 0, len(referrers))
+	for _, referrer := range referrers {
+		out = append(out, map[string]interface{}{
+			"digest":        referrer.Digest,
+			"artifact_type": referrer.ArtifactType,
+			"media_type":    referrer.MediaType,
+			"size":          int(referrer.Size),
+		})
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetRegistryReferrers(t *testing.T) {
+	digest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	referrersAPI := true
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case referrersAPI && r.URL.Path == "/v2/app/referrers/"+digest && r.URL.Query().Get("last") == "":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			w.Header().Set("Link", `</v2/app/referrers/`+digest+`?last=sig>; rel="next"`)
+			fmt.Fprint(w, `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+				`"artifactType":"application/vnd.dev.cosign.artifact.sig.v1+json","digest":"sha256:sig","size":100}]}`)
+		case referrersAPI && r.URL.Path == "/v2/app/referrers/"+digest:
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			fmt.Fprint(w, `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+				`"artifactType":"application/spdx+json","digest":"sha256:sbom","size":200}]}`)
+		case !referrersAPI && r.URL.Path == "/v2/app/manifests/sha256-1111111111111111111111111111111111111111111111111111111111111111":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			fmt.Fprint(w, `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+				`"artifactType":"application/vnd.dev.cosign.artifact.sig.v1+json","digest":"sha256:tagged","size":300}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	providerConfig := &ProviderConfig{}
+
+	referrers, err := getRegistryReferrers(context.Background(), registry, "app", digest, "", "", "", true, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"digest": "sha256:sig", "artifact_type": "application/vnd.dev.cosign.artifact.sig.v1+json", "media_type": "application/vnd.oci.image.manifest.v1+json", "size": 100},
+		map[string]interface{}{"digest": "sha256:sbom", "artifact_type": "application/spdx+json", "media_type": "application/vnd.oci.image.manifest.v1+json", "size": 200},
+	}
+	if flattened := flattenRegistryReferrers(referrers); !reflect.DeepEqual(flattened, expected) {
+		t.Errorf("Expected the referrers of all pages %v, but got %v", expected, flattened)
+	}
+
+	referrers, err = getRegistryReferrers(context.Background(), registry, "app", digest, "application/spdx+json", "", "", true, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != "sha256:sbom" {
+		t.Errorf("Expected only the SBOM to match the artifact type, but got %v", referrers)
+	}
+
+	referrersAPI = false
+	referrers, err = getRegistryReferrers(context.Background(), registry, "app", digest, "", "", "", true, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error with the tag schema, but got %s", err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != "sha256:tagged" {
+		t.Errorf("Expected the referrers of the sha256- tag, but got %v", referrers)
+	}
+
+	referrers, err = getRegistryReferrers(context.Background(), registry, "app", "sha256:none", "", "", "", true, providerConfig)
+	if err != nil || len(referrers) != 0 {
+		t.Errorf("Expected no referrers without a tag, but got %v and %v", referrers, err)
+	}
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceDockerRegistryStats() *schema.Resource {
+	return &schema.Resource{
+		Description: "Reports the number of registry calls the provider made so far in the current plan or apply, e.g. to measure the effect of `cache_ttl` and `max_concurrent_requests`. Calls are counted up to the read of this data source, use `depends_on` to read it after the data sources and resources to measure. The counts are logged at debug level as well.",
+
+		ReadContext: dataSourceDockerRegistryStatsRead,
+
+		Schema: map[string]*schema.Schema{
+			"requests": {
+				Type:        schema.TypeInt,
+				Description: "The number of requests sent to registries and token servers, including retries.",
+				Computed:    true,
+			},
+			"manifest_requests": {
+				Type:        schema.TypeInt,
+				Description: "The number of manifest requests, e.g. to resolve a tag to its digest, including retries.",
+				Computed:    true,
+			},
+			"token_exchanges": {
+				Type:        schema.TypeInt,
+				Description: "The number of bearer tokens requested from token servers with credentials or a refresh token.",
+				Computed:    true,
+			},
+			"token_cache_hits": {
+				Type:        schema.TypeInt,
+				Description: "The number of bearer tokens taken from the token cache instead of being requested.",
+				Computed:    true,
+			},
+			"digest_cache_hits": {
+				Type:        schema.TypeInt,
+				Description: "The number of digests of `docker_registry_image` taken from the digest cache instead of being requested, see `cache_ttl`.",
+				Computed:    true,
+			},
+			"retries": {
+				Type:        schema.TypeInt,
+				Description: "The number of requests retried after a 429 or 5xx response, see `max_retries`.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceDockerRegistryStatsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+
+	stats := providerConfig.RegistryStats.snapshot()
+	fields := map[string]interface{}{}
+	for name, count := range stats {
+		d.Set(name, count)
+		fields[name] = count
+	}
+	tflog.Debug(ctx, "Registry calls so far", fields)
+
+	d.SetId("registry-stats")
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceDockerRegistryStatsRead(t *testing.T) {
+	unavailable := true
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token":"foo"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if unavailable {
+			unavailable = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+		fmt.Fprint(w, `{"schemaVersion":2}`)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{
+		AuthConfigs:        &AuthConfigs{},
+		RegistryTokens:     newRegistryTokenCache(),
+		RegistryDigests:    newRegistryDigestCache(time.Minute),
+		RegistryStats:      &registryStats{},
+		RegistryMaxRetries: 1,
+		RegistryRetryDelay: time.Millisecond,
+	}
+	// the second read takes the digest from the cache, the third one only the token
+	for _, tag := range []string{"1.0", "1.0", "1.1"} {
+		d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryImage().Schema, map[string]interface{}{
+			"name":                 registry + "/app:" + tag,
+			"username":             "user",
+			"password":             "secret",
+			"insecure_skip_verify": true,
+		})
+		if diags := dataSourceDockerRegistryImageRead(context.Background(), d, providerConfig); diags.HasError() {
+			t.Fatalf("Expected no error, but got %v", diags)
+		}
+	}
+
+	d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryStats().Schema, map[string]interface{}{})
+	if diags := dataSourceDockerRegistryStatsRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+
+	for name, expected := range map[string]int{"token_exchanges": 1, "digest_cache_hits": 1, "retries": 1} {
+		if count := d.Get(name).(int); count != expected {
+			t.Errorf("Expected %s to be %d, but got %d", name, expected, count)
+		}
+	}
+	if d.Get("token_cache_hits").(int) < 1 {
+		t.Errorf("Expected the token to be taken from the cache after the first request")
+	}
+	if manifestRequests, requests := d.Get("manifest_requests").(int), d.Get("requests").(int); manifestRequests < 3 || requests <= manifestRequests {
+		t.Errorf("Expected the manifest requests to be counted among all requests, but got %d of %d", manifestRequests, requests)
+	}
+	if d.Id() == "" {
+		t.Error("Expected an id to be set")
+	}
+}
@@ -0,0 +1,440 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Matches the URL of the next page in a Link header, e.g. </v2/alpine/tags/list?last=3.16&n=100>; rel="next"
+var registryNextLinkRegexp = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+func dataSourceDockerRegistryTags() *schema.Resource {
+	return &schema.Resource{
+		Description: "Lists the tags of a repository in a Docker Registry.",
+
+		ReadContext: dataSourceDockerRegistryTagsRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "The name of the repository, without a tag. e.g. `alpine` or `ghcr.io/owner/app`",
+				Required:    true,
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"limit": {
+				Type:             schema.TypeInt,
+				Description:      "The maximum number of tags listed, sent to the registry as `n` parameter. No further pages are requested once the limit is reached. `0` lists all tags. Defaults to `0`",
+				Optional:         true,
+				Default:          0,
+				ValidateDiagFunc: validateIntegerGeqThan(0),
+			},
+
+			"tags": {
+				Type:        schema.TypeList,
+				Description: "The tags of the repository in the order returned by the registry, at most `limit`.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"tag_prefix": {
+				Type:        schema.TypeString,
+				Description: "Only tags starting with this prefix are returned in `matching_tags`, e.g. `v1.`. The tags are filtered after the tag list was fetched, all pages up to `limit` are still requested from the registry.",
+				Optional:    true,
+			},
+
+			"tag_regex": {
+				Type:             schema.TypeString,
+				Description:      "Only tags matching this regular expression are returned in `matching_tags`, e.g. `^v[0-9]+\\.[0-9]+\\.[0-9]+$`. Combined with `tag_prefix`, tags have to match both.",
+				Optional:         true,
+				ValidateDiagFunc: validateStringIsRegex(),
+			},
+
+			"matching_tags": {
+				Type:        schema.TypeList,
+				Description: "The tags matching `tag_prefix` and `tag_regex` in the order returned by the registry. All tags if neither is set.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"digest": {
+				Type:             schema.TypeString,
+				Description:      "If set, the tags of `matching_tags` are resolved to the digest they refer to and those referring to this digest are returned in `digest_tags`, e.g. `sha256:...`. The digest is compared with the digest of the manifest list or manifest of a tag, like `sha256_digest` of `docker_registry_image`. Resolving costs one manifest request per tag of `matching_tags`, for large repositories use `limit`, `tag_prefix` or `tag_regex` to reduce the number of requests.",
+				Optional:         true,
+				ValidateDiagFunc: validateStringMatchesPattern(`^[a-z0-9]+([+._-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`),
+			},
+
+			"digest_concurrency": {
+				Type:             schema.TypeInt,
+				Description:      "The maximum number of manifest requests sent at the same time to resolve the tags for `digest`. The requests of all data sources and resources are still limited by `max_concurrent_requests` of the provider. Defaults to `4`",
+				Optional:         true,
+				Default:          4,
+				ValidateDiagFunc: validateIntegerGeqThan(1),
+			},
+
+			"digest_tags": {
+				Type:        schema.TypeList,
+				Description: "The tags of `matching_tags` referring to `digest` in the order returned by the registry. Empty if `digest` is not set.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func dataSourceDockerRegistryTagsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	name := d.Get("name").(string)
+	providerConfig := meta.(*ProviderConfig)
+	pullOpts := normalizeImageRef(name, providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+
+	username, password, err := getImageRefCredentials(ctx, pullOpts, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	tags, err := getRegistryTags(ctx, pullOpts.Registry, pullOpts.Repository, username, password, d.Get("insecure_skip_verify").(bool), d.Get("limit").(int), providerConfig)
+	if err != nil {
+		return registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to list the tags of %s", pullOpts.Repository), pullOpts.Repository, pullOpts.Registry, err)
+	}
+
+	// the pattern is validated at plan time
+	tagRegexp := regexp.MustCompile(d.Get("tag_regex").(string))
+
+	matchingTags := filterRegistryTags(tags, d.Get("tag_prefix").(string), tagRegexp)
+
+	digestTags := []string{}
+	if digest := d.Get("digest").(string); digest != "" {
+		digestTags, err = getRegistryTagsByDigest(ctx, pullOpts.Registry, pullOpts.Repository, matchingTags, digest, username, password, d.Get("insecure_skip_verify").(bool), d.Get("digest_concurrency").(int), providerConfig)
+		if err != nil {
+			return registryErrorDiagnostics(fmt.Sprintf("Got error when attempting to resolve the tags of %s referring to %s", pullOpts.Repository, digest), pullOpts.Repository, pullOpts.Registry, err)
+		}
+	}
+
+	d.SetId(pullOpts.Registry + "/" + pullOpts.Repository)
+	d.Set("tags", tags)
+	d.Set("matching_tags", matchingTags)
+	d.Set("digest_tags", digestTags)
+
+	return nil
+}
+
+// getRegistryTagsByDigest returns the tags referring to digest, keeping their order. At most concurrency tags are
+// resolved at the same time, the tokens of the token cache are shared by all of them. Tags which were deleted
+// after they were listed are skipped.
+func getRegistryTagsByDigest(ctx context.Context, registry, image string, tags []string, digest, username, password string, insecureSkipVerify bool, concurrency int, providerConfig *ProviderConfig) ([]string, error) {
+	digests := make([]string, len(tags))
+	errs := make([]error, len(tags))
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, tag := range tags {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result, err := getImageDigest(ctx, registry, image, tag, username, password, insecureSkipVerify, false, providerConfig)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			digests[i] = result.Digest
+		}(i, tag)
+	}
+	wg.Wait()
+
+	matching := []string{}
+	for i, tag := range tags {
+		if errs[i] != nil {
+			if isManifestNotFound(errs[i]) {
+				log.Printf("[WARN] Skipping tag %s of %s, it was deleted while resolving the tags referring to %s", tag, image, digest)
+				continue
+			}
+			return nil, fmt.Errorf("Error resolving the digest of tag %s: %w", tag, errs[i])
+		}
+		if digests[i] == digest {
+			matching = append(matching, tag)
+		}
+	}
+	return matching, nil
+}
+
+// getRegistryTags lists the tags of the repository, following the pages announced in the Link header until limit
+// tags are listed. A limit of 0 lists all tags.
+func getRegistryTags(ctx context.Context, registry, image, username, password string, insecureSkipVerify bool, limit int, providerConfig *ProviderConfig) ([]string, error) {
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+
+	tags := []string{}
+	next := registryURL(registry, providerConfig) + "/v2/" + image + "/tags/list"
+	if limit > 0 {
+		// registries may return fewer tags per page, but the links to the next pages keep n
+		next += "?n=" + strconv.Itoa(limit)
+	}
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating registry request: %s", err)
+		}
+
+		page, link, err := getRegistryTagsPage(client, req, registry, username, password, providerConfig)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page...)
+		if limit > 0 && len(tags) >= limit {
+			return tags[:limit], nil
+		}
+
+		next = ""
+		if link != "" {
+			nextURL, err := resolveNextLink(req.URL, link, providerConfig)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing the link to the next page of tags: %s", err)
+			}
+			next = nextURL.String()
+		}
+	}
+
+	return tags, nil
+}
+
+// getRegistryTagsPage returns the tags of a single page and the possibly relative link to the next page
+func getRegistryTagsPage(client *http.Client, req *http.Request, registry, username, password string, providerConfig *ProviderConfig) ([]string, string, error) {
+	release, err := providerConfig.RegistryRequests.acquire(req.Context())
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	resp, err := doRegistryRequest(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := readRegistryResponseBody(resp, providerConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tagList := &registryTagList{}
+	if err := json.Unmarshal(body, tagList); err != nil {
+		return nil, "", fmt.Errorf("Error parsing tag list: %s", err)
+	}
+
+	return tagList.Tags, parseNextLink(resp.Header.Get("Link")), nil
+}
+
+// Limits the digest requests of resolveRegistryTag, tags are tried from the highest version down
+const maxResolvedTagCandidates = 20
+
+// versionTagRegexp matches tags which look like a version and are therefore unlikely to be moved, e.g. 1.2.3 or v1.2.3-alpine
+var versionTagRegexp = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+)*(-[0-9A-Za-z.-]+)?$`)
+
+// semverTagRegexp matches tags which are semantic versions with major, minor and patch version, e.g. 1.2.3, v1.2.3 or
+// 1.2.3-rc.1. Build metadata cannot be part of a tag.
+var semverTagRegexp = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`)
+
+// resolveLatestSemverTag returns the tag of the repository with the highest semantic version satisfying the constraints
+func resolveLatestSemverTag(ctx context.Context, registry, image, username, password string, insecureSkipVerify bool, constraints version.Constraints, providerConfig *ProviderConfig) (string, error) {
+	tags, err := getRegistryTags(ctx, registry, image, username, password, insecureSkipVerify, 0, providerConfig)
+	if err != nil {
+		return "", fmt.Errorf("Unable to list the tags of %s: %w", image, err)
+	}
+
+	tag, ok := latestSemverTag(tags, constraints)
+	if !ok {
+		if len(constraints) > 0 {
+			return "", fmt.Errorf("None of the %d tags of %s is a semantic version satisfying %s", len(tags), image, constraints)
+		}
+		return "", fmt.Errorf("None of the %d tags of %s is a semantic version", len(tags), image)
+	}
+	return tag, nil
+}
+
+// latestSemverTag returns the tag with the highest semantic version satisfying the constraints, false if there is none.
+// Pre-releases are only picked if a constraint names a pre-release of the same version, like in Terraform. Of tags with
+// the same version, e.g. 1.2.3 and v1.2.3, the first in the list is picked.
+func latestSemverTag(tags []string, constraints version.Constraints) (string, bool) {
+	var latest *version.Version
+	latestTag := ""
+	for _, tag := range tags {
+		if !semverTagRegexp.MatchString(tag) {
+			continue
+		}
+		v, err := version.NewSemver(tag)
+		if err != nil {
+			continue
+		}
+		if v.Prerelease() != "" && len(constraints) == 0 {
+			continue
+		}
+		if !constraints.Check(v) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+			latestTag = tag
+		}
+	}
+	return latestTag, latest != nil
+}
+
+// resolveRegistryTag returns the most specific version tag of the repository referring to digest, e.g. 1.2.3 for 1.2.
+// The lookup is best-effort, an empty string is returned if the registry does not allow listing tags or none matches.
+func resolveRegistryTag(ctx context.Context, registry, image, tag, digest, username, password string, insecureSkipVerify, fallback bool, providerConfig *ProviderConfig) string {
+	tags, err := getRegistryTags(ctx, registry, image, username, password, insecureSkipVerify, 0, providerConfig)
+	if err != nil {
+		log.Printf("[WARN] Unable to list the tags of %s to resolve tag %s: %s", image, tag, err)
+		return ""
+	}
+
+	candidates := resolvedTagCandidates(tags, tag)
+	if len(candidates) > maxResolvedTagCandidates {
+		candidates = candidates[:maxResolvedTagCandidates]
+	}
+	for _, candidate := range candidates {
+		result, err := getImageDigest(ctx, registry, image, candidate, username, password, insecureSkipVerify, fallback, providerConfig)
+		if err != nil {
+			log.Printf("[WARN] Unable to read the digest of %s:%s to resolve tag %s: %s", image, candidate, tag, err)
+			continue
+		}
+		if result.Digest == digest {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+// resolvedTagCandidates returns the version tags more specific than tag, e.g. 1.2.3 and 1.2.4 for 1.2, highest version first.
+// Any version tag is more specific than a tag which is not a version, e.g. latest or stable.
+func resolvedTagCandidates(tags []string, tag string) []string {
+	candidates := []string{}
+	for _, candidate := range tags {
+		if candidate == tag || !versionTagRegexp.MatchString(candidate) {
+			continue
+		}
+		if versionTagRegexp.MatchString(tag) && !strings.HasPrefix(candidate, tag+".") && !strings.HasPrefix(candidate, tag+"-") {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return compareTagVersions(candidates[i], candidates[j]) > 0
+	})
+	return candidates
+}
+
+// compareTagVersions compares the numeric components of two version tags, a tag with a suffix like -rc1 or -alpine
+// is lower than the same version without one
+func compareTagVersions(a, b string) int {
+	aVersion, aSuffix := splitTagVersion(a)
+	bVersion, bSuffix := splitTagVersion(b)
+	for i := 0; i < len(aVersion) || i < len(bVersion); i++ {
+		var aPart, bPart int
+		if i < len(aVersion) {
+			aPart = aVersion[i]
+		}
+		if i < len(bVersion) {
+			bPart = bVersion[i]
+		}
+		if aPart != bPart {
+			return aPart - bPart
+		}
+	}
+
+	switch {
+	case aSuffix == bSuffix:
+		return 0
+	case aSuffix == "":
+		return 1
+	case bSuffix == "":
+		return -1
+	}
+	return strings.Compare(aSuffix, bSuffix)
+}
+
+// splitTagVersion splits a version tag into its numeric components and suffix, e.g. v1.2.3-rc1 into [1 2 3] and rc1
+func splitTagVersion(tag string) ([]int, string) {
+	tag = strings.TrimPrefix(tag, "v")
+	suffix := ""
+	if i := strings.Index(tag, "-"); i != -1 {
+		tag, suffix = tag[:i], tag[i+1:]
+	}
+
+	parts := strings.Split(tag, ".")
+	version := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, _ := strconv.Atoi(part)
+		version = append(version, n)
+	}
+	return version, suffix
+}
+
+// filterRegistryTags returns the tags starting with prefix and matching pattern, keeping their order
+func filterRegistryTags(tags []string, prefix string, pattern *regexp.Regexp) []string {
+	matching := []string{}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) && pattern.MatchString(tag) {
+			matching = append(matching, tag)
+		}
+	}
+	return matching
+}
+
+// resolveNextLink resolves the possibly relative link to the next page against the URL of the current page. Registries
+// behind a path prefix announce their links without it, which is added to links starting with /v2/.
+func resolveNextLink(base *url.URL, link string, providerConfig *ProviderConfig) (*url.URL, error) {
+	if providerConfig.RegistryAPIPathPrefix != "" && strings.HasPrefix(link, "/v2/") {
+		link = providerConfig.RegistryAPIPathPrefix + link
+	}
+	return base.Parse(link)
+}
+
+// parseNextLink returns the URL with rel="next" of a Link header, or an empty string if there is none
+func parseNextLink(header string) string {
+	match := registryNextLinkRegexp.FindStringSubmatch(header)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// registryTagList is the response of the tags/list endpoint
+type registryTagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
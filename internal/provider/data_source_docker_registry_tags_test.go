@@ -0,0 +1,288 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestGetRegistryTags(t *testing.T) {
+	tokenRequests := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			fmt.Fprint(w, `{"token":"foo","expires_in":300}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:library/alpine:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Query().Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/library/alpine/tags/list?last=3.15&n=2>; rel="next"`)
+			fmt.Fprint(w, `{"name":"library/alpine","tags":["3.14","3.15"]}`)
+		case "3.15":
+			fmt.Fprint(w, `{"name":"library/alpine","tags":["3.16"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	tags, err := getRegistryTags(context.Background(), registry, "library/alpine", "", "", true, 0, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if expected := []string{"3.14", "3.15", "3.16"}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected tags %v of all pages, but got %v", expected, tags)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("Expected the token to be reused for all pages, but got %d token requests", tokenRequests)
+	}
+}
+
+func TestGetRegistryTags_limit(t *testing.T) {
+	pages := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		query := r.URL.Query()
+		if n := query.Get("n"); n != "3" {
+			t.Errorf("Expected the limit as n parameter, but got '%s'", n)
+		}
+		// like Docker Hub, the registry returns fewer tags per page than asked for
+		switch query.Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/library/alpine/tags/list?last=3.15&n=3>; rel="next"`)
+			fmt.Fprint(w, `{"name":"library/alpine","tags":["3.14","3.15"]}`)
+		case "3.15":
+			w.Header().Set("Link", `</v2/library/alpine/tags/list?last=3.17&n=3>; rel="next"`)
+			fmt.Fprint(w, `{"name":"library/alpine","tags":["3.16","3.17"]}`)
+		default:
+			t.Errorf("Expected no page to be requested after the limit was reached, but got %s", r.URL)
+			fmt.Fprint(w, `{"name":"library/alpine","tags":["3.18"]}`)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	tags, err := getRegistryTags(context.Background(), registry, "library/alpine", "", "", true, 3, &ProviderConfig{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if expected := []string{"3.14", "3.15", "3.16"}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected the first %d tags %v, but got %v", len(expected), expected, tags)
+	}
+	if pages != 2 {
+		t.Errorf("Expected 2 pages to be requested, but got %d", pages)
+	}
+}
+
+func TestResolvedTagCandidates(t *testing.T) {
+	tags := []string{"latest", "1.2", "1.2.3", "1.2.10", "1.2.10-rc1", "1.2-alpine", "1.20.0", "1", "v2.0.0", "sha256-abc.sig", "main"}
+	cases := map[string][]string{
+		"1.2":    {"1.2.10", "1.2.10-rc1", "1.2.3", "1.2-alpine"},
+		"1":      {"1.20.0", "1.2.10", "1.2.10-rc1", "1.2.3", "1.2", "1.2-alpine"},
+		"latest": {"v2.0.0", "1.20.0", "1.2.10", "1.2.10-rc1", "1.2.3", "1.2", "1.2-alpine", "1"},
+		"1.2.10": {"1.2.10-rc1"},
+		"2":      {},
+	}
+	for tag, expected := range cases {
+		if candidates := resolvedTagCandidates(tags, tag); !reflect.DeepEqual(candidates, expected) {
+			t.Errorf("Expected candidates %v for %s, but got %v", expected, tag, candidates)
+		}
+	}
+}
+
+func TestResolveRegistryTag(t *testing.T) {
+	digests := map[string]string{"1.2": "sha256:new", "1.2.3": "sha256:old", "1.2.4": "sha256:new", "latest": "sha256:new"}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/app/tags/list" {
+			fmt.Fprint(w, `{"name":"app","tags":["latest","1.2","1.2.3","1.2.4"]}`)
+			return
+		}
+		digest, ok := digests[strings.TrimPrefix(r.URL.Path, "/v2/app/manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	if tag := resolveRegistryTag(context.Background(), registry, "app", "1.2", "sha256:new", "", "", true, false, &ProviderConfig{}); tag != "1.2.4" {
+		t.Errorf("Expected 1.2 to resolve to 1.2.4, but got '%s'", tag)
+	}
+	if tag := resolveRegistryTag(context.Background(), registry, "app", "1.2", "sha256:other", "", "", true, false, &ProviderConfig{}); tag != "" {
+		t.Errorf("Expected no tag for an unknown digest, but got '%s'", tag)
+	}
+	if tag := resolveRegistryTag(context.Background(), registry, "missing", "1.2", "sha256:new", "", "", true, false, &ProviderConfig{}); tag != "" {
+		t.Errorf("Expected no tag if the tags cannot be listed, but got '%s'", tag)
+	}
+}
+
+func TestGetRegistryTagsByDigest(t *testing.T) {
+	digests := map[string]string{"latest": "sha256:new", "1.0": "sha256:old", "1.1": "sha256:new", "1.1.0": "sha256:new", "1.2": "sha256:other"}
+	var running, maxRunning int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		digest, ok := digests[strings.TrimPrefix(r.URL.Path, "/v2/app/manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	// the deleted tag was removed after the tags were listed
+	tags := []string{"latest", "1.0", "deleted", "1.1", "1.1.0", "1.2"}
+	matching, err := getRegistryTagsByDigest(context.Background(), registry, "app", tags, "sha256:new", "", "", true, 2, &ProviderConfig{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if expected := []string{"latest", "1.1", "1.1.0"}; !reflect.DeepEqual(matching, expected) {
+		t.Errorf("Expected the tags %v, but got %v", expected, matching)
+	}
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, but got %d", maxRunning)
+	}
+
+	matching, err = getRegistryTagsByDigest(context.Background(), registry, "app", tags, "sha256:unknown", "", "", true, 2, &ProviderConfig{})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if len(matching) != 0 {
+		t.Errorf("Expected no tags for an unknown digest, but got %v", matching)
+	}
+}
+
+func TestGetRegistryTagsByDigest_cancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := getRegistryTagsByDigest(ctx, registry, "app", []string{"1.0", "1.1", "1.2"}, "sha256:foo", "", "", true, 1, &ProviderConfig{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the resolution of the tags to be cancelled, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected a prompt return once cancelled, but it took %s", elapsed)
+	}
+}
+
+func TestFilterRegistryTags(t *testing.T) {
+	tags := []string{"latest", "v1.0.0", "v1.1.0-rc1", "v1.1.0", "v2.0.0", "sha256-abc.sig"}
+	cases := []struct {
+		prefix   string
+		pattern  string
+		expected []string
+	}{
+		{"", "", tags},
+		{"v1.", "", []string{"v1.0.0", "v1.1.0-rc1", "v1.1.0"}},
+		{"", `^v[0-9]+\.[0-9]+\.[0-9]+$`, []string{"v1.0.0", "v1.1.0", "v2.0.0"}},
+		{"v1.", `^v[0-9]+\.[0-9]+\.[0-9]+$`, []string{"v1.0.0", "v1.1.0"}},
+		{"v3.", "", []string{}},
+	}
+	for _, c := range cases {
+		if matching := filterRegistryTags(tags, c.prefix, regexp.MustCompile(c.pattern)); !reflect.DeepEqual(matching, c.expected) {
+			t.Errorf("Expected %v for prefix '%s' and pattern '%s', but got %v", c.expected, c.prefix, c.pattern, matching)
+		}
+	}
+}
+
+func TestResolveNextLink(t *testing.T) {
+	base, _ := url.Parse("https://gw.example.com/registry/v2/library/alpine/tags/list?n=2")
+	cases := []struct {
+		prefix   string
+		link     string
+		expected string
+	}{
+		{"", "/v2/library/alpine/tags/list?last=3.15&n=2", "https://gw.example.com/v2/library/alpine/tags/list?last=3.15&n=2"},
+		{"/registry", "/v2/library/alpine/tags/list?last=3.15&n=2", "https://gw.example.com/registry/v2/library/alpine/tags/list?last=3.15&n=2"},
+		// links rewritten by the gateway are followed as is
+		{"/registry", "/registry/v2/library/alpine/tags/list?last=3.15&n=2", "https://gw.example.com/registry/v2/library/alpine/tags/list?last=3.15&n=2"},
+		{"/registry", "https://other.example.com/v2/library/alpine/tags/list?last=3.15", "https://other.example.com/v2/library/alpine/tags/list?last=3.15"},
+	}
+	for _, c := range cases {
+		next, err := resolveNextLink(base, c.link, &ProviderConfig{RegistryAPIPathPrefix: c.prefix})
+		if err != nil {
+			t.Fatalf("Expected no error for %s, but got %s", c.link, err)
+		}
+		if next.String() != c.expected {
+			t.Errorf("Expected %s for %s with prefix %q, but got %s", c.expected, c.link, c.prefix, next)
+		}
+	}
+}
+
+func TestLatestSemverTag(t *testing.T) {
+	tags := []string{"latest", "1.4", "1.3.9", "v1.4.2", "1.4.10-alpine", "1.5.0-rc.1", "1.10.0", "2.0.0-beta", "01.2.3"}
+	cases := []struct {
+		constraint string
+		expected   string
+	}{
+		{"", "1.10.0"},
+		{">= 1.2, < 1.10", "v1.4.2"},
+		{"~> 1.3.0", "1.3.9"},
+		{"= 1.5.0-rc.1", "1.5.0-rc.1"},
+		{">= 3.0", ""},
+	}
+	for _, c := range cases {
+		var constraints version.Constraints
+		if c.constraint != "" {
+			constraints = version.MustConstraints(version.NewConstraint(c.constraint))
+		}
+		tag, ok := latestSemverTag(tags, constraints)
+		if tag != c.expected || ok != (c.expected != "") {
+			t.Errorf("Expected %q for constraint %q, but got %q", c.expected, c.constraint, tag)
+		}
+	}
+}
+
+func TestParseNextLink(t *testing.T) {
+	cases := map[string]string{
+		`</v2/alpine/tags/list?last=3.16&n=100>; rel="next"`:              "/v2/alpine/tags/list?last=3.16&n=100",
+		`<https://registry.example.com/v2/app/tags/list?last=b>;rel=next`: "https://registry.example.com/v2/app/tags/list?last=b",
+		`</v2/alpine/tags/list?last=3.10>; rel="prev"`:                    "",
+		"": "",
+	}
+	for header, expected := range cases {
+		if link := parseNextLink(header); link != expected {
+			t.Errorf("Expected '%s' for '%s', but got '%s'", expected, header, link)
+		}
+	}
+}
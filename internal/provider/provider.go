@@ -2,12 +2,19 @@ package provider
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli/config/configfile"
 	"github.com/docker/docker/api/types"
@@ -91,7 +98,7 @@ func New(version string) func() *schema.Provider {
 							"address": {
 								Type:        schema.TypeString,
 								Required:    true,
-								Description: "Address of the registry",
+								Description: "Address of the registry. Use the `http://` scheme for registries served over plain HTTP, registry requests of the data sources then do not use TLS. A wildcard like `*.internal.example.com` applies the credentials to all registries of the domain, `*` to all registries, unless credentials are configured for the registry itself.",
 							},
 
 							"username": {
@@ -125,28 +132,283 @@ func New(version string) func() *schema.Provider {
 								ConflictsWith: []string{"registry_auth.username", "registry_auth.password", "registry_auth.config_file"},
 								Description:   "Plain content of the docker json file for registry auth",
 							},
+
+							"unix_socket": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Description: "Path of a Unix socket the registry data sources and resources connect to instead of dialing the host of `address`, e.g. for a local registry in an air-gapped CI. Requests are still sent with the host of `address`, other registries are not affected.",
+							},
+
+							"tls_server_name": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Description: "The server name the registry data sources and resources send as SNI in the TLS handshake and verify the certificate of the registry against, instead of the host of `address`, e.g. for a registry behind a load balancer routing by a different name. Not applied to connections through a proxy, see `proxy_url`.",
+							},
+
+							"tls_renegotiation": {
+								Type:        schema.TypeBool,
+								Optional:    true,
+								Default:     false,
+								Description: "If `true`, the registry may renegotiate the TLS session once per connection, e.g. legacy load balancers asking for a client certificate after the request was sent. Only TLS 1.2 and lower support renegotiation. Not applied to connections through a proxy, see `proxy_url`. Defaults to `false`",
+							},
+
+							"auth_mode": {
+								Type:             schema.TypeString,
+								Optional:         true,
+								ValidateDiagFunc: validateStringMatchesPattern(`^(challenge|bearer|basic|ntlm)$`),
+								Description:      "How the registry data sources and resources authenticate against the registry. `challenge` answers the bearer challenge of the registry as described by the distribution spec. `basic` sends basic auth with every request and does not exchange it for a token. `bearer` sends the password as bearer token with every request, e.g. an access token. `ntlm` negotiates NTLM with the credentials of `ntlm_user`, `ntlm_password` and `ntlm_domain` instead of using the registry credentials, e.g. for registries behind Windows-authenticated reverse proxies. Defaults to `challenge`, or the strategy set in `registry_auth_strategies`.",
+							},
 						},
 					},
 				},
+
+				"default_registry": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					ValidateDiagFunc: validateStringMatchesPattern(`^[^/]+$`),
+					Description:      "The registry host images without a registry in their name are read from by the registry data sources and resources, e.g. `registry.example.com` or `localhost:5000`. Defaults to Docker Hub.",
+				},
+
+				"hub_registry": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					ValidateDiagFunc: validateStringMatchesPattern(`^[^/]+$`),
+					Description:      "The registry host Docker Hub images are read from by the registry data sources and resources, e.g. a registry compatible with Docker Hub or a fake Hub in tests. Official images are looked up under `library/` on this host as well. Unlike `registry_mirrors`, credentials are looked up for this host. Defaults to `registry-1.docker.io`",
+				},
+
+				"registry_mirrors": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "Mirrors, e.g. pull-through caches, the registry data sources and resources send their requests to instead of the registry, keyed by the registry host, e.g. `{ \"docker.io\" = \"mirror.example.com\" }`. The mirror is given as host or as base URL like `http://localhost:5000`. Image names and credentials are still those of the mirrored registry.",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+
+				"api_path_prefix": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					ValidateDiagFunc: validateStringMatchesPattern(`^(/[^/?#\s]+)+/?$`),
+					Description:      "The path the registry API is served under, inserted before `/v2/` in the requests of the registry data sources and resources, e.g. `/registry` for a registry reachable as `https://gw.example.com/registry/v2/`. Applies to all registries, use a provider alias for registries served at the root. Mirrors given as base URL in `registry_mirrors` are used as is. Token servers are requested at the realm the registry announces.",
+				},
+
+				"registry_headers": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "Additional HTTP headers sent with the requests of the registry data sources and resources, including token requests, e.g. an API key or tenant ID required by a registry gateway. Headers set by the provider itself, like `Accept` and `Authorization`, take precedence, an `Authorization` header is only sent with requests the provider does not authenticate itself. The `Docker-Distribution-Api-Version: registry/2.0` header the provider sends with manifest requests can be overridden.",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+
+				"registry_auth_strategies": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "The authentication strategies of registries deviating from the distribution spec, keyed by the registry host. `github` sends the password as personal access token like the GitHub container registry expects, e.g. for GitHub Enterprise hosts. `distribution` uses basic auth and the token exchange of the distribution spec. The auth modes of `registry_auth`, i.e. `challenge`, `basic`, `bearer` and `ntlm`, are accepted as well. `ghcr.io` uses `github` by default.",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+
+				"ntlm_user": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					RequiredWith: []string{"ntlm_password"},
+					Description:  "The user name for registries with auth mode `ntlm`",
+				},
+
+				"ntlm_password": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Sensitive:    true,
+					RequiredWith: []string{"ntlm_user"},
+					Description:  "The password for registries with auth mode `ntlm`",
+				},
+
+				"ntlm_domain": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "The Windows domain of `ntlm_user`, if any",
+				},
+
+				"docker_config_file": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Path to a Docker CLI config file or the directory containing it, whose stored credentials are used for registries. Credentials set in `registry_auth` take precedence. Defaults to the `DOCKER_CONFIG` environment variable or `~/.docker/config.json`, a missing default file is ignored.",
+				},
+
+				"aws_profile": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "The AWS profile used to obtain an authorization token for Amazon ECR registries which have no credentials configured. Defaults to the AWS default credential chain.",
+				},
+
+				"aws_region": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "The AWS region used to obtain an authorization token for Amazon ECR registries. Defaults to the region of the registry host.",
+				},
+
+				"google_credentials": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					Description: "The JSON key of a Google service account used to obtain an access token for Google Container Registry (`gcr.io`) and Artifact Registry (`*-docker.pkg.dev`) registries which have no credentials configured. Defaults to the application default credentials, images are read anonymously if there are none.",
+				},
+
+				"azure_tenant_id": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					RequiredWith: []string{"azure_client_id"},
+					Description:  "The Azure AD tenant of the service principal used to obtain a token for Azure Container Registries which have no credentials configured.",
+				},
+
+				"azure_client_id": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					RequiredWith: []string{"azure_tenant_id", "azure_client_secret"},
+					Description:  "The client ID of the service principal used for Azure Container Registries.",
+				},
+
+				"azure_client_secret": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Sensitive:    true,
+					RequiredWith: []string{"azure_client_id"},
+					Description:  "The client secret of the service principal used for Azure Container Registries.",
+				},
+
+				"azure_authority_host": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Default:     "https://login.microsoftonline.com",
+					Description: "The Azure AD endpoint used to authenticate the service principal, e.g. for sovereign clouds. Defaults to `https://login.microsoftonline.com`.",
+				},
+
+				"ca_cert_pem": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "PEM-encoded CA certificates trusted in addition to the system CAs when talking to registries, e.g. for a registry with a certificate issued by a corporate CA. The `insecure_skip_verify` attribute of data sources and resources takes precedence and disables the verification entirely.",
+				},
+
+				"ca_cert_file": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "Path to a file with PEM-encoded CA certificates trusted in addition to the system CAs when talking to registries. Can be combined with `ca_cert_pem`.",
+				},
+
+				"client_cert_pem": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					RequiredWith: []string{"client_key_pem"},
+					Description:  "PEM-encoded client certificate presented to registries which require mutual TLS. Used in addition to the credentials of `registry_auth`.",
+				},
+
+				"client_key_pem": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Sensitive:    true,
+					RequiredWith: []string{"client_cert_pem"},
+					Description:  "PEM-encoded private key of `client_cert_pem`.",
+				},
+
+				"proxy_url": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					ValidateDiagFunc: validateStringMatchesPattern(`^(https?|socks5)://`),
+					Description:      "The proxy used for requests against registries, including token requests, e.g. `http://proxy.example.com:3128` or `socks5://localhost:1080`. Defaults to the proxy given by the `HTTPS_PROXY`, `HTTP_PROXY` and `NO_PROXY` environment variables.",
+				},
+
+				"max_concurrent_requests": {
+					Type:             schema.TypeInt,
+					Optional:         true,
+					Default:          5,
+					ValidateDiagFunc: validateIntegerGeqThan(0),
+					Description:      "The maximum number of registry requests running at the same time, shared by all registry data sources and resources. Avoids hitting rate limits of registries when many images are read in parallel. `0` disables the limit. Defaults to `5`",
+				},
+
+				"max_retries": {
+					Type:             schema.TypeInt,
+					Optional:         true,
+					Default:          3,
+					ValidateDiagFunc: validateIntegerGeqThan(0),
+					Description:      "How often a registry request is retried if the registry answers with `429 Too Many Requests` or a `5xx` status. Defaults to `3`",
+				},
+
+				"retry_delay": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					Default:          "1s",
+					ValidateDiagFunc: validateDurationGeq0(),
+					Description:      "The initial delay between retries of registry requests, doubled with every retry. A `Retry-After` header sent by the registry takes precedence. Defaults to `1s`",
+				},
+
+				"timeout": {
+					Type:             schema.TypeInt,
+					Optional:         true,
+					Default:          30,
+					ValidateDiagFunc: validateIntegerGeqThan(0),
+					Description:      "The timeout in seconds of a single request against a registry, including token requests. `0` disables the timeout. Defaults to `30`",
+				},
+
+				"max_response_size": {
+					Type:             schema.TypeInt,
+					Optional:         true,
+					Default:          defaultRegistryMaxResponseSize,
+					ValidateDiagFunc: validateIntegerGeqThan(1024),
+					Description:      "The maximum size in bytes of manifests, image configs, tag lists and token responses read from registries. Larger responses are an error. Defaults to `4194304` (4 MiB)",
+				},
+
+				"cache_ttl": {
+					Type:             schema.TypeInt,
+					Optional:         true,
+					Default:          60,
+					ValidateDiagFunc: validateIntegerGeqThan(0),
+					Description:      "The number of seconds the digest a tag was resolved to by the registry data sources is reused, so that an image referenced by several data sources is only resolved once per operation. Writes of the registry resources clear the cache. `0` disables the cache. Defaults to `60`",
+				},
+
+				"tls_min_version": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					Default:          "1.2",
+					ValidateDiagFunc: validateStringMatchesPattern(`^1\.[0-3]$`),
+					Description:      "The minimum TLS version accepted from registries, one of `1.0`, `1.1`, `1.2` and `1.3`. Defaults to `1.2`",
+				},
+
+				"user_agent": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "The `User-Agent` header sent with requests against registries, including token requests, e.g. to pass a web application firewall blocking the default. Defaults to `terraform-provider-docker/<version>`",
+				},
 			},
 
 			ResourcesMap: map[string]*schema.Resource{
-				"docker_container":      resourceDockerContainer(),
-				"docker_image":          resourceDockerImage(),
-				"docker_registry_image": resourceDockerRegistryImage(),
-				"docker_network":        resourceDockerNetwork(),
-				"docker_volume":         resourceDockerVolume(),
-				"docker_config":         resourceDockerConfig(),
-				"docker_secret":         resourceDockerSecret(),
-				"docker_service":        resourceDockerService(),
-				"docker_plugin":         resourceDockerPlugin(),
+				"docker_container":         resourceDockerContainer(),
+				"docker_image":             resourceDockerImage(),
+				"docker_registry_image":    resourceDockerRegistryImage(),
+				"docker_registry_manifest": resourceDockerRegistryManifest(),
+				"docker_registry_mirror":   resourceDockerRegistryMirror(),
+				"docker_registry_pin":      resourceDockerRegistryPin(),
+				"docker_network":           resourceDockerNetwork(),
+				"docker_volume":            resourceDockerVolume(),
+				"docker_config":            resourceDockerConfig(),
+				"docker_secret":            resourceDockerSecret(),
+				"docker_service":           resourceDockerService(),
+				"docker_plugin":            resourceDockerPlugin(),
 			},
 
 			DataSourcesMap: map[string]*schema.Resource{
-				"docker_registry_image": dataSourceDockerRegistryImage(),
-				"docker_network":        dataSourceDockerNetwork(),
-				"docker_plugin":         dataSourceDockerPlugin(),
-				"docker_image":          dataSourceDockerImage(),
+				"docker_registry_image":          dataSourceDockerRegistryImage(),
+				"docker_registry_image_manifest": dataSourceDockerRegistryImageManifest(),
+				"docker_registry_referrers":      dataSourceDockerRegistryReferrers(),
+				"docker_registry_auth_check":     dataSourceDockerRegistryAuthCheck(),
+				"docker_registries":              dataSourceDockerRegistries(),
+				"docker_image_reference":         dataSourceDockerImageReference(),
+				"docker_registry_tags":           dataSourceDockerRegistryTags(),
+				"docker_registry_stats":          dataSourceDockerRegistryStats(),
+				"docker_network":                 dataSourceDockerNetwork(),
+				"docker_plugin":                  dataSourceDockerPlugin(),
+				"docker_image":                   dataSourceDockerImage(),
 			},
 		}
 
@@ -182,6 +444,66 @@ func configure(version string, p *schema.Provider) func(context.Context, *schema
 			return nil, diag.Errorf("Error pinging Docker server: %s", err)
 		}
 
+		retryDelay, err := time.ParseDuration(d.Get("retry_delay").(string))
+		if err != nil {
+			return nil, diag.Errorf("Error parsing retry_delay: %s", err)
+		}
+
+		var caCertFileContent []byte
+		if caCertFile := d.Get("ca_cert_file").(string); caCertFile != "" {
+			caCertFileContent, err = ioutil.ReadFile(caCertFile)
+			if err != nil {
+				return nil, diag.Errorf("Error reading ca_cert_file: %s", err)
+			}
+		}
+		registryRootCAs, err := buildRegistryCertPool([]byte(d.Get("ca_cert_pem").(string)), caCertFileContent)
+		if err != nil {
+			return nil, diag.Errorf("Error loading registry CA certificates: %s", err)
+		}
+
+		var registryClientCertificates []tls.Certificate
+		if clientCertPEM, clientKeyPEM := d.Get("client_cert_pem").(string), d.Get("client_key_pem").(string); clientCertPEM != "" && clientKeyPEM != "" {
+			clientCertificate, err := tls.X509KeyPair([]byte(clientCertPEM), []byte(clientKeyPEM))
+			if err != nil {
+				return nil, diag.Errorf("Error loading registry client certificate: %s", err)
+			}
+			registryClientCertificates = []tls.Certificate{clientCertificate}
+		}
+
+		var registryProxyURL *url.URL
+		if proxyURL := d.Get("proxy_url").(string); proxyURL != "" {
+			registryProxyURL, err = url.Parse(proxyURL)
+			if err != nil {
+				return nil, diag.Errorf("Error parsing proxy_url: %s", err)
+			}
+		}
+
+		hubRegistry := d.Get("hub_registry").(string)
+		if hubRegistry == "" {
+			hubRegistry = dockerHubRegistry
+		}
+
+		registryMirrors := make(map[string]string)
+		for registry, mirror := range d.Get("registry_mirrors").(map[string]interface{}) {
+			// image names on Docker Hub are resolved against the Hub registry
+			if dockerHubHosts[registry] {
+				registry = hubRegistry
+			}
+			registryMirrors[registry] = mirror.(string)
+		}
+
+		apiPathPrefix := strings.TrimSuffix(d.Get("api_path_prefix").(string), "/")
+
+		userAgent := d.Get("user_agent").(string)
+		if userAgent == "" {
+			userAgent = "terraform-provider-docker/" + version
+		}
+
+		registryHeaders := make(http.Header)
+		for name, value := range d.Get("registry_headers").(map[string]interface{}) {
+			registryHeaders.Set(name, value.(string))
+		}
+
 		authConfigs := &AuthConfigs{}
 
 		if v, ok := d.GetOk("registry_auth"); ok { // TODO load them anyway
@@ -192,9 +514,76 @@ func configure(version string, p *schema.Provider) func(context.Context, *schema
 			}
 		}
 
+		configuredAuthStrategies := make(map[string]string)
+		for registry, name := range d.Get("registry_auth_strategies").(map[string]interface{}) {
+			configuredAuthStrategies[registry] = name.(string)
+		}
+		registryUnixSockets := make(map[string]string)
+		registryTLSOverrides := make(map[string]registryTLSOverride)
+		// the auth mode of a registry_auth block takes precedence
+		for _, auth := range d.Get("registry_auth").([]interface{}) {
+			auth := auth.(map[string]interface{})
+			if authMode := auth["auth_mode"].(string); authMode != "" {
+				configuredAuthStrategies[registryAuthModeHost(auth["address"].(string))] = authMode
+			}
+			if unixSocket := auth["unix_socket"].(string); unixSocket != "" {
+				registryUnixSockets[registryAuthModeHost(auth["address"].(string))] = unixSocket
+			}
+			if override := (registryTLSOverride{serverName: auth["tls_server_name"].(string), renegotiation: auth["tls_renegotiation"].(bool)}); override != (registryTLSOverride{}) {
+				registryTLSOverrides[registryAuthModeHost(auth["address"].(string))] = override
+			}
+		}
+		var ntlm *ntlmAuthStrategy
+		if ntlmUser := d.Get("ntlm_user").(string); ntlmUser != "" {
+			ntlm = &ntlmAuthStrategy{
+				username: ntlmUser,
+				password: d.Get("ntlm_password").(string),
+				domain:   d.Get("ntlm_domain").(string),
+			}
+		}
+		authStrategies, err := registryAuthStrategies(configuredAuthStrategies, ntlm)
+		if err != nil {
+			return nil, diag.Errorf("Error loading registry_auth_strategies: %s", err)
+		}
+
+		dockerConfig, err := loadDockerConfigAuths(authConfigs, d.Get("docker_config_file").(string))
+		if err != nil {
+			return nil, diag.Errorf("Error loading docker_config_file: %s", err)
+		}
+
 		providerConfig := ProviderConfig{
-			DockerClient: client,
-			AuthConfigs:  authConfigs,
+			DockerClient:               client,
+			AuthConfigs:                authConfigs,
+			DefaultRegistry:            d.Get("default_registry").(string),
+			HubRegistry:                hubRegistry,
+			DockerConfig:               dockerConfig,
+			AWSProfile:                 d.Get("aws_profile").(string),
+			AWSRegion:                  d.Get("aws_region").(string),
+			GoogleCredentials:          d.Get("google_credentials").(string),
+			AzureTenantID:              d.Get("azure_tenant_id").(string),
+			AzureClientID:              d.Get("azure_client_id").(string),
+			AzureClientSecret:          d.Get("azure_client_secret").(string),
+			AzureAuthorityHost:         d.Get("azure_authority_host").(string),
+			AuthStrategies:             authStrategies,
+			RegistryRootCAs:            registryRootCAs,
+			RegistryClientCertificates: registryClientCertificates,
+			RegistryMirrors:            registryMirrors,
+			RegistryAPIPathPrefix:      apiPathPrefix,
+			RegistryHeaders:            registryHeaders,
+			RegistryUserAgent:          userAgent,
+			RegistryUnixSockets:        registryUnixSockets,
+			RegistryTLSOverrides:       registryTLSOverrides,
+			RegistryProxyURL:           registryProxyURL,
+			RegistryRequests:           newRegistryRequestLimiter(d.Get("max_concurrent_requests").(int)),
+			RegistryTransports:         newRegistryTransportCache(),
+			RegistryTokens:             newRegistryTokenCache(),
+			RegistryDigests:            newRegistryDigestCache(time.Duration(d.Get("cache_ttl").(int)) * time.Second),
+			RegistryStats:              &registryStats{},
+			RegistryMaxRetries:         d.Get("max_retries").(int),
+			RegistryRetryDelay:         retryDelay,
+			RegistryMaxResponseSize:    int64(d.Get("max_response_size").(int)),
+			RegistryTimeout:            time.Duration(d.Get("timeout").(int)) * time.Second,
+			RegistryTLSMinVersion:      tlsVersions[d.Get("tls_min_version").(string)],
 		}
 
 		return &providerConfig, nil
@@ -207,6 +596,38 @@ type AuthConfigs struct {
 	Configs map[string]types.AuthConfig `json:"configs"`
 }
 
+// lookup returns the auth config of the registry address, e.g. https://registry.internal.example.com. Without one
+// for the address, the most specific wildcard config of the domain is returned, e.g. https://*.internal.example.com
+// before https://*.example.com, and finally the default config https://* of all registries. Wildcards match any
+// port and only addresses of the same scheme.
+func (c *AuthConfigs) lookup(address string) (types.AuthConfig, bool) {
+	if c == nil {
+		return types.AuthConfig{}, false
+	}
+	if auth, ok := c.Configs[address]; ok {
+		return auth, true
+	}
+
+	scheme := "https://"
+	// DevSkim: ignore DS137138
+	if strings.HasPrefix(address, "http://") {
+		// DevSkim: ignore DS137138
+		scheme = "http://"
+	}
+	host := convertToHostname(address)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	for labels := strings.Split(host, "."); len(labels) > 1; labels = labels[1:] {
+		if auth, ok := c.Configs[scheme+"*."+strings.Join(labels[1:], ".")]; ok {
+			return auth, true
+		}
+	}
+
+	auth, ok := c.Configs[scheme+"*"]
+	return auth, ok
+}
+
 // Take the given registry_auth schemas and return a map of registry auth configurations
 func providerSetToRegistryAuth(authList []interface{}) (*AuthConfigs, error) {
 	authConfigs := AuthConfigs{
@@ -280,6 +701,108 @@ func providerSetToRegistryAuth(authList []interface{}) (*AuthConfigs, error) {
 	return &authConfigs, nil
 }
 
+// loadDockerConfigAuths adds the credentials stored in the Docker CLI config file to the auth configs,
+// entries already present take precedence. Errors for the default file are only logged.
+func loadDockerConfigAuths(authConfigs *AuthConfigs, filePath string) (*configfile.ConfigFile, error) {
+	explicit := filePath != ""
+	if !explicit {
+		filePath = os.Getenv("DOCKER_CONFIG")
+	}
+	if filePath == "" {
+		filePath = "~/.docker/config.json"
+	}
+
+	if strings.HasPrefix(filePath, "~/") {
+		usr, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		filePath = strings.Replace(filePath, "~", usr.HomeDir, 1)
+	}
+	// DOCKER_CONFIG names the directory of the config file for the Docker CLI
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		filePath = filepath.Join(filePath, "config.json")
+	}
+
+	r, err := os.Open(filePath)
+	if err != nil {
+		if explicit {
+			return nil, err
+		}
+		log.Printf("[DEBUG] Not loading registry credentials from %s: %s", filePath, err)
+		return nil, nil
+	}
+	defer r.Close()
+
+	c, err := loadConfigFile(r)
+	if err != nil {
+		if explicit {
+			return nil, fmt.Errorf("Error parsing docker config json: %v", err)
+		}
+		log.Printf("[WARN] Not loading registry credentials from %s: %s", filePath, err)
+		return nil, nil
+	}
+
+	if authConfigs.Configs == nil {
+		authConfigs.Configs = make(map[string]types.AuthConfig)
+	}
+	for address, auth := range c.GetAuthConfigs() {
+		serverAddress := dockerConfigServerAddress(address)
+		if _, ok := authConfigs.Configs[serverAddress]; ok {
+			continue
+		}
+		authConfigs.Configs[serverAddress] = types.AuthConfig{
+			ServerAddress: serverAddress,
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+			RegistryToken: auth.RegistryToken,
+		}
+	}
+
+	return c, nil
+}
+
+// getCredentialHelperCredentials asks the credential helper configured for the registry with credsStore or
+// credHelpers in the Docker CLI config file. Identity tokens are returned with the identityTokenUsername.
+func getCredentialHelperCredentials(dockerConfig *configfile.ConfigFile, registry string) (string, string, error) {
+	if dockerConfig == nil || (dockerConfig.CredentialsStore == "" && len(dockerConfig.CredentialHelpers) == 0) {
+		return "", "", nil
+	}
+
+	// the Docker CLI stores the credentials of Docker Hub under its legacy index address
+	serverAddress := registry
+	if dockerHubHosts[registry] {
+		serverAddress = "https://index.docker.io/v1/"
+	}
+
+	auth, err := dockerConfig.GetCredentialsStore(serverAddress).Get(serverAddress)
+	if err != nil {
+		return "", "", err
+	}
+	if auth.IdentityToken != "" {
+		return identityTokenUsername, auth.IdentityToken, nil
+	}
+
+	return auth.Username, auth.Password, nil
+}
+
+// dockerConfigServerAddress maps the keys of the Docker CLI config file, e.g. https://index.docker.io/v1/,
+// to the addresses auth configs are looked up with
+func dockerConfigServerAddress(address string) string {
+	hostname := convertToHostname(address)
+	if dockerHubHosts[hostname] {
+		hostname = dockerHubRegistry
+	}
+
+	// DevSkim: ignore DS137138
+	if strings.HasPrefix(address, "http://") {
+		// DevSkim: ignore DS137138
+		return "http://" + hostname
+	}
+	return normalizeRegistryAddress(hostname)
+}
+
 func loadConfigFile(configData io.Reader) (*configfile.ConfigFile, error) {
 	configFile := configfile.New("")
 	if err := configFile.LoadFromReader(configData); err != nil {
@@ -2,10 +2,16 @@ package provider
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"testing"
 
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
@@ -44,6 +50,122 @@ func TestProvider(t *testing.T) {
 	}
 }
 
+func TestLoadDockerConfigAuths(t *testing.T) {
+	dir := t.TempDir()
+	configJSON := `{"auths":{` +
+		`"https://index.docker.io/v1/":{"auth":"aHViOmh1YnBhc3M="},` +
+		`"ghcr.io":{"auth":"Z2g6Z2hwYXNz"},` +
+		`"http://localhost:5000":{"auth":"bG9jYWw6bG9jYWxwYXNz"}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(configJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	authConfigs := &AuthConfigs{Configs: map[string]types.AuthConfig{
+		"https://ghcr.io": {ServerAddress: "https://ghcr.io", Username: "explicit", Password: "explicitpass"},
+	}}
+	// the directory is accepted like DOCKER_CONFIG of the Docker CLI
+	if _, err := loadDockerConfigAuths(authConfigs, dir); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+
+	expected := map[string]string{
+		"https://registry-1.docker.io": "hub:hubpass",
+		"https://ghcr.io":              "explicit:explicitpass",
+		"http://localhost:5000":        "local:localpass",
+	}
+	for address, credentials := range expected {
+		auth := authConfigs.Configs[address]
+		if auth.Username+":"+auth.Password != credentials {
+			t.Errorf("Expected credentials %s for %s, but got %s:%s", credentials, address, auth.Username, auth.Password)
+		}
+	}
+
+	if _, err := loadDockerConfigAuths(authConfigs, filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing explicitly configured file")
+	}
+	os.Setenv("DOCKER_CONFIG", filepath.Join(dir, "missing"))
+	defer os.Unsetenv("DOCKER_CONFIG")
+	if _, err := loadDockerConfigAuths(authConfigs, ""); err != nil {
+		t.Errorf("Expected a missing default file to be ignored, but got %s", err)
+	}
+}
+
+func TestAuthConfigsLookup(t *testing.T) {
+	authConfigs := &AuthConfigs{Configs: map[string]types.AuthConfig{
+		"https://registry.internal.example.com": {Username: "exact"},
+		"https://*.internal.example.com":        {Username: "internal"},
+		"https://*.example.com":                 {Username: "example"},
+		"https://*":                             {Username: "default"},
+		"http://*.insecure.example.com":         {Username: "insecure"},
+	}}
+	cases := []struct {
+		address  string
+		expected string
+	}{
+		{"https://registry.internal.example.com", "exact"},
+		{"https://other.internal.example.com", "internal"},
+		{"https://a.b.internal.example.com:5000", "internal"},
+		{"https://internal.example.com", "example"},
+		{"https://ghcr.io", "default"},
+		{"https://localhost:5000", "default"},
+		{"http://registry.insecure.example.com", "insecure"},
+		{"http://registry.example.com", ""},
+	}
+	for _, c := range cases {
+		auth, ok := authConfigs.lookup(c.address)
+		if auth.Username != c.expected || ok != (c.expected != "") {
+			t.Errorf("Expected the auth config '%s' for %s, but got '%s'", c.expected, c.address, auth.Username)
+		}
+	}
+
+	if _, ok := (*AuthConfigs)(nil).lookup("https://ghcr.io"); ok {
+		t.Errorf("Expected no auth config without auth configs")
+	}
+}
+
+func TestGetCredentialHelperCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake credential helper is a shell script")
+	}
+
+	dir := t.TempDir()
+	helper := `#!/bin/sh
+read server
+case "$server" in
+  https://index.docker.io/v1/) echo '{"ServerURL":"https://index.docker.io/v1/","Username":"hub","Secret":"hubpass"}' ;;
+  registry.example.com) echo '{"ServerURL":"registry.example.com","Username":"<token>","Secret":"refresh"}' ;;
+  *) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(helper), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dockerConfig := configfile.New("")
+	dockerConfig.CredentialHelpers = map[string]string{"registry.example.com": "fake"}
+	dockerConfig.CredentialsStore = "fake"
+
+	cases := []struct {
+		registry string
+		username string
+		password string
+	}{
+		{"registry-1.docker.io", "hub", "hubpass"},
+		{"registry.example.com", identityTokenUsername, "refresh"},
+		{"unknown.example.com", "", ""},
+	}
+	for _, c := range cases {
+		username, password, err := getCredentialHelperCredentials(dockerConfig, c.registry)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, but got %s", c.registry, err)
+		}
+		if username != c.username || password != c.password {
+			t.Errorf("Expected credentials %s:%s for %s, but got %s:%s", c.username, c.password, c.registry, username, password)
+		}
+	}
+}
+
 func TestAccDockerProvider_WithIncompleteRegistryAuth(t *testing.T) {
 	resource.Test(t, resource.TestCase{
 		PreCheck:          func() { testAccPreCheck(t) },
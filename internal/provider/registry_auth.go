@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// Credential helpers return this user name if the secret is an identity token, i.e. an OAuth2 refresh token
+const identityTokenUsername = "<token>"
+
+// registryTokenClientID identifies the provider to token servers, which require a client ID for the refresh token grant
+const registryTokenClientID = "terraform-provider-docker"
+
+// AuthStrategy authenticates requests against a registry. Strategies are stateless, the credentials
+// resolved for the registry are passed to every call.
+type AuthStrategy interface {
+	// Authorize sets the credentials on a request before it is sent to the registry
+	Authorize(req *http.Request, username, password string)
+	// Token answers a bearer challenge of the registry, given as the parsed WWW-Authenticate header
+	Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error)
+}
+
+// namedAuthStrategies are the strategies which can be assigned to registry hosts in the provider configuration
+var namedAuthStrategies = map[string]AuthStrategy{
+	"distribution": distributionAuthStrategy{},
+	"github":       githubAuthStrategy{},
+	// the auth modes of registry_auth
+	"challenge": distributionAuthStrategy{},
+	"basic":     basicAuthStrategy{},
+	"bearer":    accessTokenAuthStrategy{},
+	// ntlm is configured with the ntlm_* credentials of the provider, see registryAuthStrategies
+}
+
+// defaultRegistryAuthStrategies returns the strategies of registries deviating from the distribution spec
+func defaultRegistryAuthStrategies() map[string]AuthStrategy {
+	return map[string]AuthStrategy{
+		"ghcr.io": githubAuthStrategy{},
+	}
+}
+
+// registryAuthModeHost returns the registry host the auth mode of a registry_auth block applies to
+func registryAuthModeHost(address string) string {
+	host := convertToHostname(address)
+	if dockerHubHosts[host] {
+		return dockerHubRegistry
+	}
+	return host
+}
+
+// registryAuthStrategies returns the default strategies overridden by the strategies configured by name for registry hosts.
+// ntlm is the strategy of the auth mode ntlm, nil if the provider is configured without NTLM credentials.
+func registryAuthStrategies(configured map[string]string, ntlm *ntlmAuthStrategy) (map[string]AuthStrategy, error) {
+	strategies := defaultRegistryAuthStrategies()
+	for registry, name := range configured {
+		if name == "ntlm" {
+			if ntlm == nil {
+				return nil, fmt.Errorf("The auth mode ntlm of registry %s requires ntlm_user and ntlm_password", registry)
+			}
+			strategies[registry] = *ntlm
+			continue
+		}
+
+		strategy, ok := namedAuthStrategies[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown auth strategy %q for registry %s", name, registry)
+		}
+		strategies[registry] = strategy
+	}
+	return strategies, nil
+}
+
+// authStrategy returns the strategy for the registry host. Credentials obtained from a cloud provider
+// are recognized by their user name, all other registries follow the distribution spec.
+func (c *ProviderConfig) authStrategy(registry, username string) AuthStrategy {
+	if strategy, ok := c.AuthStrategies[registry]; ok {
+		return strategy
+	}
+
+	switch username {
+	case gcrAccessTokenUsername:
+		return accessTokenAuthStrategy{}
+	case acrRefreshTokenUsername, identityTokenUsername:
+		return refreshTokenAuthStrategy{}
+	}
+	return distributionAuthStrategy{}
+}
+
+// distributionAuthStrategy sends basic auth and exchanges it for a token as described by the distribution spec,
+// e.g. Docker Hub or Harbor
+type distributionAuthStrategy struct{}
+
+func (distributionAuthStrategy) Authorize(req *http.Request, username, password string) {
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+}
+
+func (distributionAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	return getRegistryToken(ctx, client, challenge, username, password, providerConfig)
+}
+
+// basicAuthStrategy only sends basic auth, for registries with broken bearer challenges which accept basic auth on every request
+type basicAuthStrategy struct{}
+
+func (basicAuthStrategy) Authorize(req *http.Request, username, password string) {
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+}
+
+func (basicAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	return nil, fmt.Errorf("Bad credentials: the registry requested a bearer token, which is not obtained with auth mode basic")
+}
+
+// githubAuthStrategy sends the base64 encoded personal access token as bearer token, as the GitHub container registry expects
+type githubAuthStrategy struct{}
+
+func (githubAuthStrategy) Authorize(req *http.Request, username, password string) {
+	if username != "" {
+		req.Header.Set("Authorization", "Bearer "+b64.StdEncoding.EncodeToString([]byte(password)))
+	}
+}
+
+func (githubAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	return getRegistryToken(ctx, client, challenge, username, password, providerConfig)
+}
+
+// accessTokenAuthStrategy sends the password as bearer token, e.g. an OAuth2 access token accepted by GCR and Artifact Registry as is
+type accessTokenAuthStrategy struct{}
+
+func (accessTokenAuthStrategy) Authorize(req *http.Request, username, password string) {
+	req.Header.Set("Authorization", "Bearer "+password)
+}
+
+func (accessTokenAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	return getRegistryToken(ctx, client, challenge, username, password, providerConfig)
+}
+
+// refreshTokenAuthStrategy posts a refresh token to the token endpoint instead of using basic auth, e.g. an
+// identity token of a credential helper or an ACR refresh token. Requests are anonymous until challenged.
+type refreshTokenAuthStrategy struct{}
+
+func (refreshTokenAuthStrategy) Authorize(req *http.Request, username, password string) {}
+
+func (refreshTokenAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	params := url.Values{}
+	params.Set("grant_type", "refresh_token")
+	params.Set("service", challenge["service"])
+	params.Set("scope", challenge["scope"])
+	params.Set("client_id", registryTokenClientID)
+	params.Set("refresh_token", password)
+
+	token := &TokenResponse{}
+	if err := postRegistryForm(ctx, client, challenge["realm"], params, token, providerConfig); err != nil {
+		return nil, fmt.Errorf("Error obtaining an access token with the refresh token: %s", err)
+	}
+
+	return token, nil
+}
+
+// ntlmAuthStrategy authenticates every request with NTLM, e.g. against registries behind Windows-authenticated
+// reverse proxies. The credentials are sent as basic auth, which the transport converts into the NTLM negotiation
+// if the server asks for it. The registry credentials are not used and bearer challenges are not answered.
+type ntlmAuthStrategy struct {
+	username string
+	password string
+	domain   string
+}
+
+func (s ntlmAuthStrategy) Authorize(req *http.Request, username, password string) {
+	user := s.username
+	if s.domain != "" {
+		user = s.domain + "\\" + s.username
+	}
+	req.SetBasicAuth(user, s.password)
+}
+
+func (ntlmAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	return nil, fmt.Errorf("Bad credentials: the registry requested a bearer token, which is not obtained with auth mode ntlm")
+}
+
+// registryNTLMTransport negotiates NTLM for the registry hosts with auth mode ntlm, the requests to all other hosts
+// are sent as is
+type registryNTLMTransport struct {
+	hosts     map[string]bool
+	transport http.RoundTripper
+}
+
+func (t registryNTLMTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hosts[strings.ToLower(req.URL.Host)] {
+		return ntlmssp.Negotiator{RoundTripper: t.transport}.RoundTrip(req)
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// ntlmHosts returns the registry hosts with auth mode ntlm
+func (c *ProviderConfig) ntlmHosts() map[string]bool {
+	hosts := make(map[string]bool)
+	for registry, strategy := range c.AuthStrategies {
+		if _, ok := strategy.(ntlmAuthStrategy); ok {
+			hosts[strings.ToLower(registry)] = true
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ACR expects this user name along with a refresh token as password, the same convention is used by `az acr login`
+const acrRefreshTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+// acrRegistryRegexp matches Azure Container Registries like myregistry.azurecr.io, including sovereign clouds
+var acrRegistryRegexp = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(io|cn|us)$`)
+
+// isACRRegistry returns true if the registry host is an Azure Container Registry
+func isACRRegistry(registry string) bool {
+	return acrRegistryRegexp.MatchString(strings.ToLower(registry))
+}
+
+// getACRCredentials exchanges an Azure AD token of the configured service principal for an ACR refresh token.
+// The refresh token is returned as password along with the user name ACR expects for refresh tokens.
+func getACRCredentials(ctx context.Context, registry string, providerConfig *ProviderConfig) (string, string, error) {
+	client := newRegistryHTTPClient(providerConfig, false)
+
+	aadToken, err := getAzureADToken(ctx, client, providerConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "access_token")
+	params.Set("service", registry)
+	params.Set("tenant", providerConfig.AzureTenantID)
+	params.Set("access_token", aadToken)
+
+	refreshToken := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	if err := postRegistryForm(ctx, client, registryURL(registry, providerConfig)+"/oauth2/exchange", params, &refreshToken, providerConfig); err != nil {
+		return "", "", fmt.Errorf("Error exchanging the Azure AD token for an ACR refresh token: %s", err)
+	}
+	if refreshToken.RefreshToken == "" {
+		return "", "", fmt.Errorf("No refresh token returned by ACR")
+	}
+
+	return acrRefreshTokenUsername, refreshToken.RefreshToken, nil
+}
+
+// getAzureADToken obtains an access token for the service principal with the client credentials grant
+func getAzureADToken(ctx context.Context, client *http.Client, providerConfig *ProviderConfig) (string, error) {
+	params := url.Values{}
+	params.Set("grant_type", "client_credentials")
+	params.Set("client_id", providerConfig.AzureClientID)
+	params.Set("client_secret", providerConfig.AzureClientSecret)
+	params.Set("scope", "https://management.azure.com/.default")
+
+	tokenURL := strings.TrimSuffix(providerConfig.AzureAuthorityHost, "/") + "/" + url.PathEscape(providerConfig.AzureTenantID) + "/oauth2/v2.0/token"
+	token := &TokenResponse{}
+	if err := postRegistryForm(ctx, client, tokenURL, params, token, providerConfig); err != nil {
+		return "", fmt.Errorf("Error obtaining an Azure AD token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("No access token returned by Azure AD")
+	}
+
+	return token.AccessToken, nil
+}
+
+// postRegistryForm posts the URL encoded form and decodes the JSON response into result
+func postRegistryForm(ctx context.Context, client *http.Client, url string, params url.Values, result interface{}, providerConfig *ProviderConfig) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(params.Encode()))
+	if err != nil {
+		return fmt.Errorf("Error creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	setRegistryHeaders(req, providerConfig)
+
+	resp, err := doLoggedRegistryRequest(ctx, client, req, providerConfig)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Got bad response: %s", resp.Status)
+	}
+
+	body, err := readRegistryResponseBody(resp, providerConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("Error parsing response: %s", err)
+	}
+
+	return nil
+}
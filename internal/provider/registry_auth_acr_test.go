@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsACRRegistry(t *testing.T) {
+	for _, registry := range []string{"myregistry.azurecr.io", "MyRegistry.azurecr.io", "myregistry.azurecr.cn"} {
+		if !isACRRegistry(registry) {
+			t.Errorf("Expected '%s' to be an ACR registry", registry)
+		}
+	}
+	for _, registry := range []string{"azurecr.io", "myregistry.azurecr.io.example.com", "registry-1.docker.io"} {
+		if isACRRegistry(registry) {
+			t.Errorf("Expected '%s' not to be an ACR registry", registry)
+		}
+	}
+}
+
+func TestGetACRCredentials(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenant := r.Header.Get("X-Tenant-Id"); tenant != "team-a" {
+			t.Errorf("Expected the configured header with every request, but got %q for %s", tenant, r.URL.Path)
+		}
+		if userAgent := r.Header.Get("User-Agent"); userAgent != "terraform-provider-docker/test" {
+			t.Errorf("Expected the User-Agent of the provider, but got %q for %s", userAgent, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			if r.PostFormValue("client_id") != "client" || r.PostFormValue("client_secret") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"aad"}`)
+		case "/oauth2/exchange":
+			if r.PostFormValue("grant_type") != "access_token" || r.PostFormValue("access_token") != "aad" || r.PostFormValue("tenant") != "tenant" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"refresh_token":"refresh"}`)
+		case "/oauth2/token":
+			if r.Method != "POST" || r.PostFormValue("grant_type") != "refresh_token" || r.PostFormValue("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"acr"}`)
+		default:
+			if r.Header.Get("Authorization") != "Bearer acr" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/oauth2/token",service="myregistry.azurecr.io",scope="repository:app:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", "sha256:foo")
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+	providerConfig := &ProviderConfig{
+		AzureTenantID:      "tenant",
+		AzureClientID:      "client",
+		AzureClientSecret:  "secret",
+		AzureAuthorityHost: server.URL,
+		RegistryRootCAs:    rootCAs,
+		RegistryHeaders:    http.Header{"X-Tenant-Id": []string{"team-a"}},
+		RegistryUserAgent:  "terraform-provider-docker/test",
+	}
+
+	username, password, err := getACRCredentials(context.Background(), registry, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if username != acrRefreshTokenUsername || password != "refresh" {
+		t.Fatalf("Expected the refresh token as credentials, but got '%s' and '%s'", username, password)
+	}
+
+	result, err := getImageDigest(context.Background(), registry, "app", "latest", username, password, false, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected the refresh token to be exchanged for an access token, but got %s", err)
+	}
+	if result.Digest != "sha256:foo" {
+		t.Errorf("Expected digest sha256:foo, but got %s", result.Digest)
+	}
+
+	providerConfig.AzureClientSecret = "wrong"
+	if _, _, err := getACRCredentials(context.Background(), registry, providerConfig); err == nil {
+		t.Errorf("Expected an error for invalid service principal credentials")
+	}
+}
@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+)
+
+// artifactoryRealmRegexp matches the token endpoint Artifactory serves for each Docker repository under its key,
+// e.g. https://artifactory.example.com/artifactory/api/docker/docker-virtual/v2/token
+var artifactoryRealmRegexp = regexp.MustCompile(`/artifactory/api/docker/([^/]+)/v2/token$`)
+
+// artifactoryRepositoryKey returns the key of the Artifactory repository the token endpoint belongs to, e.g.
+// docker-virtual, or an empty string if the realm is not the token endpoint of an Artifactory repository
+func artifactoryRepositoryKey(realm string) string {
+	match := artifactoryRealmRegexp.FindStringSubmatch(realm)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// artifactoryTokenScope returns the scope to request from the token endpoint in realm. With the repository path
+// method, images are named like artifactory.example.com/docker-virtual/app, but the token endpoint of the
+// repository docker-virtual issues tokens for the image app. The repository key is therefore stripped from a
+// scope derived from the request path. Scopes for other token servers are returned as is.
+func artifactoryTokenScope(realm, scope string) string {
+	key := artifactoryRepositoryKey(realm)
+	prefix := "repository:" + key + "/"
+	if key == "" || !strings.HasPrefix(scope, prefix) {
+		return scope
+	}
+	return "repository:" + strings.TrimPrefix(scope, prefix)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestArtifactoryTokenScope(t *testing.T) {
+	cases := []struct {
+		realm    string
+		scope    string
+		expected string
+	}{
+		{"https://artifactory.example.com/artifactory/api/docker/docker-virtual/v2/token", "repository:docker-virtual/team/app:pull", "repository:team/app:pull"},
+		{"https://artifactory.example.com/artifactory/api/docker/docker-virtual/v2/token", "repository:team/app:pull", "repository:team/app:pull"},
+		{"https://artifactory.example.com/artifactory/api/docker/docker-virtual/v2/token", "", ""},
+		{"https://auth.docker.io/token", "repository:docker-virtual/app:pull", "repository:docker-virtual/app:pull"},
+	}
+
+	for _, c := range cases {
+		if scope := artifactoryTokenScope(c.realm, c.scope); scope != c.expected {
+			t.Errorf("Expected scope '%s' for '%s' from %s, but got '%s'", c.expected, c.scope, c.realm, scope)
+		}
+	}
+}
+
+func TestGetImageDigest_artifactoryVirtualRepository(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/artifactory/api/docker/docker-virtual/v2/token" {
+			if scope := r.URL.Query().Get("scope"); scope != "repository:team/app:pull" {
+				t.Errorf("Expected the scope within the repository, but got '%s'", scope)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"token":"foo"}`)
+			return
+		}
+		if r.URL.Path != "/v2/docker-virtual/team/app/manifests/1.0" {
+			t.Errorf("Expected the path of the virtual repository, but got %s", r.URL.Path)
+		}
+		// Artifactory omits the scope in its challenges
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/artifactory/api/docker/docker-virtual/v2/token",service="artifactory"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	// the repository key is part of the repository, even if Artifactory proxies Docker Hub
+	pullOpts := normalizeImageRef(registry+"/docker-virtual/team/app:1.0", "", registry)
+	if pullOpts.Registry != registry || pullOpts.Repository != "docker-virtual/team/app" {
+		t.Fatalf("Expected the repository docker-virtual/team/app, but got %+v", pullOpts)
+	}
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	result, err := getImageDigest(context.Background(), pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, "user", "api-key", true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result.Digest != "sha256:foo" {
+		t.Errorf("Expected digest sha256:foo, but got %s", result.Digest)
+	}
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// ecrRegistryRegexp matches private ECR registries like 123456789012.dkr.ecr.eu-central-1.amazonaws.com
+var ecrRegistryRegexp = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// isECRRegistry returns true if the registry host is a private Amazon ECR registry
+func isECRRegistry(registry string) bool {
+	return ecrRegistryRegexp.MatchString(registry)
+}
+
+// getECRRegion returns the AWS region encoded in the ECR registry host
+func getECRRegion(registry string) string {
+	matches := ecrRegistryRegexp.FindStringSubmatch(registry)
+	if matches == nil {
+		return ""
+	}
+	return matches[3]
+}
+
+// getECRCredentials obtains an authorization token for the ECR registry and returns it as username and password.
+// The AWS credentials are taken from the given profile or the default credential chain. If no region
+// is given, the region of the registry host is used.
+func getECRCredentials(ctx context.Context, registry, profile, region string) (string, string, error) {
+	if region == "" {
+		region = getECRRegion(registry)
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(region)}
+	if profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return "", "", fmt.Errorf("Error loading AWS config: %s", err)
+	}
+
+	out, err := ecr.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return "", "", fmt.Errorf("Error getting ECR authorization token: %s", err)
+	}
+	if len(out.AuthorizationData) == 0 {
+		return "", "", fmt.Errorf("No ECR authorization data returned")
+	}
+
+	return decodeECRAuthorizationToken(aws.ToString(out.AuthorizationData[0].AuthorizationToken))
+}
+
+// decodeECRAuthorizationToken splits the base64 encoded 'user:password' token returned by ECR
+func decodeECRAuthorizationToken(token string) (string, string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", fmt.Errorf("Error decoding ECR authorization token: %s", err)
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("Invalid ECR authorization token")
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestIsECRRegistry(t *testing.T) {
+	cases := map[string]string{
+		"123456789012.dkr.ecr.eu-central-1.amazonaws.com":         "eu-central-1",
+		"123456789012.dkr.ecr-fips.us-east-1.amazonaws.com":       "us-east-1",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":        "cn-north-1",
+		"registry-1.docker.io":                                    "",
+		"public.ecr.aws":                                          "",
+		"123456789012.dkr.ecr.eu-central-1.amazonaws.com.evil.io": "",
+	}
+
+	for registry, region := range cases {
+		if isECRRegistry(registry) != (region != "") {
+			t.Errorf("Expected isECRRegistry(%s) to be %t", registry, region != "")
+		}
+		if r := getECRRegion(registry); r != region {
+			t.Errorf("Expected region of %s to be '%s', but was '%s'", registry, region, r)
+		}
+	}
+}
+
+func TestDecodeECRAuthorizationToken(t *testing.T) {
+	username, password, err := decodeECRAuthorizationToken(base64.StdEncoding.EncodeToString([]byte("AWS:secret:with:colons")))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if username != "AWS" || password != "secret:with:colons" {
+		t.Errorf("Expected AWS/secret:with:colons, but got %s/%s", username, password)
+	}
+
+	if _, _, err := decodeECRAuthorizationToken("not base64"); err == nil {
+		t.Errorf("Expected an error for an invalid token")
+	}
+}
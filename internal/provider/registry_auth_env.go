@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Environment variables with the registry credentials, for CI setups without credentials in the configuration
+const (
+	registryUserEnv       = "DOCKER_REGISTRY_USER"
+	registryPasswordEnv   = "DOCKER_REGISTRY_PASS"
+	registryAuthEnvPrefix = "DOCKER_AUTH_"
+)
+
+// Characters of registry hosts which are not allowed in the names of environment variables
+var registryAuthEnvInvalidChars = regexp.MustCompile(`[^A-Z0-9]`)
+
+// registryAuthEnvName returns the environment variable with the credentials of the registry host,
+// e.g. DOCKER_AUTH_REGISTRY_EXAMPLE_COM_5000 for registry.example.com:5000 and DOCKER_AUTH_DOCKER_IO for Docker Hub
+func registryAuthEnvName(registry string) string {
+	if dockerHubHosts[registry] {
+		registry = "docker.io"
+	}
+	return registryAuthEnvPrefix + registryAuthEnvInvalidChars.ReplaceAllString(strings.ToUpper(registry), "_")
+}
+
+// getEnvRegistryCredentials returns the credentials of the registry host from the environment. DOCKER_AUTH_<HOST>
+// holds username:password of a single host, DOCKER_REGISTRY_USER and DOCKER_REGISTRY_PASS apply to the default
+// registry only, so that they are not sent to other registries.
+func getEnvRegistryCredentials(registry string, providerConfig *ProviderConfig) (string, string, error) {
+	name := registryAuthEnvName(registry)
+	if value := os.Getenv(name); value != "" {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return "", "", fmt.Errorf("Error parsing %s: expected username:password", name)
+		}
+		return parts[0], parts[1], nil
+	}
+
+	// the registry images without a registry in their name are read from, see normalizeImageRef
+	defaultRegistry := providerConfig.DefaultRegistry
+	if defaultRegistry == "" || dockerHubHosts[defaultRegistry] {
+		defaultRegistry = providerConfig.HubRegistry
+	}
+	if defaultRegistry == "" {
+		defaultRegistry = dockerHubRegistry
+	}
+	if registry == defaultRegistry {
+		return os.Getenv(registryUserEnv), os.Getenv(registryPasswordEnv), nil
+	}
+	return "", "", nil
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestRegistryAuthEnvName(t *testing.T) {
+	cases := map[string]string{
+		"registry.example.com:5000": "DOCKER_AUTH_REGISTRY_EXAMPLE_COM_5000",
+		"registry-1.docker.io":      "DOCKER_AUTH_DOCKER_IO",
+		"ghcr.io":                   "DOCKER_AUTH_GHCR_IO",
+	}
+	for registry, expected := range cases {
+		if name := registryAuthEnvName(registry); name != expected {
+			t.Errorf("Expected %s for %s, but got %s", expected, registry, name)
+		}
+	}
+}
+
+func TestGetRegistryCredentials_env(t *testing.T) {
+	t.Setenv("DOCKER_AUTH_REGISTRY_EXAMPLE_COM", "robot:pass:with:colons")
+	t.Setenv("DOCKER_AUTH_CONFIGURED_EXAMPLE_COM", "env:pass")
+	t.Setenv("DOCKER_REGISTRY_USER", "hubuser")
+	t.Setenv("DOCKER_REGISTRY_PASS", "hubpass")
+
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{Configs: map[string]types.AuthConfig{
+		"https://configured.example.com": {Username: "block", Password: "pass"},
+	}}}
+	cases := []struct {
+		registry, username, password string
+	}{
+		{"registry.example.com", "robot", "pass:with:colons"},
+		// explicit blocks and the config file take precedence
+		{"configured.example.com", "block", "pass"},
+		// the generic variables only apply to the default registry
+		{"registry-1.docker.io", "hubuser", "hubpass"},
+		{"other.example.com", "", ""},
+	}
+	for _, c := range cases {
+		username, password, err := getRegistryCredentials(context.Background(), c.registry, providerConfig)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, but got %s", c.registry, err)
+		}
+		if username != c.username || password != c.password {
+			t.Errorf("Expected %s/%s for %s, but got %s/%s", c.username, c.password, c.registry, username, password)
+		}
+	}
+
+	providerConfig.DefaultRegistry = "other.example.com"
+	if username, _, _ := getRegistryCredentials(context.Background(), "other.example.com", providerConfig); username != "hubuser" {
+		t.Errorf("Expected the generic variables to apply to the default registry, but got %s", username)
+	}
+	if username, _, _ := getRegistryCredentials(context.Background(), "registry-1.docker.io", providerConfig); username != "" {
+		t.Errorf("Expected the generic variables not to apply to Docker Hub with another default registry, but got %s", username)
+	}
+
+	t.Setenv("DOCKER_AUTH_REGISTRY_EXAMPLE_COM", "missing-password")
+	if _, _, err := getRegistryCredentials(context.Background(), "registry.example.com", providerConfig); err == nil {
+		t.Errorf("Expected an error for a malformed DOCKER_AUTH_ variable")
+	}
+}
+
+func TestDataSourceDockerRegistryImageRead_envCredentials(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "ci" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	t.Setenv(registryAuthEnvName(registry), "ci:secret")
+
+	d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryImage().Schema, map[string]interface{}{
+		"name":                 registry + "/app:1.0",
+		"insecure_skip_verify": true,
+	})
+	if diags := dataSourceDockerRegistryImageRead(context.Background(), d, &ProviderConfig{AuthConfigs: &AuthConfigs{}}); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if digest := d.Get("sha256_digest").(string); digest != "sha256:foo" {
+		t.Errorf("Expected digest sha256:foo, but got %s", digest)
+	}
+}
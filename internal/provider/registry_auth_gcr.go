@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2/google"
+)
+
+// GCR and Artifact Registry accept an OAuth2 access token along with this user name, see `gcloud auth configure-docker`
+const gcrAccessTokenUsername = "oauth2accesstoken"
+
+const gcrScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gcrRegistryRegexp matches Google Container Registry hosts like gcr.io or eu.gcr.io and
+// Artifact Registry hosts like europe-west3-docker.pkg.dev
+var gcrRegistryRegexp = regexp.MustCompile(`^(([a-z]+\.)?gcr\.io|[a-z0-9-]+-docker\.pkg\.dev)$`)
+
+// isGCRRegistry returns true if the registry host is a Google Container Registry or Artifact Registry
+func isGCRRegistry(registry string) bool {
+	return gcrRegistryRegexp.MatchString(registry)
+}
+
+// getGCRCredentials obtains an OAuth2 access token from the service account key, or from the
+// application default credentials if no key is given
+func getGCRCredentials(ctx context.Context, credentialsJSON string) (string, string, error) {
+	var credentials *google.Credentials
+	var err error
+	if credentialsJSON != "" {
+		credentials, err = google.CredentialsFromJSON(ctx, []byte(credentialsJSON), gcrScope)
+	} else {
+		credentials, err = google.FindDefaultCredentials(ctx, gcrScope)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("Error loading Google credentials: %s", err)
+	}
+
+	token, err := credentials.TokenSource.Token()
+	if err != nil {
+		return "", "", fmt.Errorf("Error obtaining a Google access token: %s", err)
+	}
+
+	return gcrAccessTokenUsername, token.AccessToken, nil
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsGCRRegistry(t *testing.T) {
+	for _, registry := range []string{"gcr.io", "eu.gcr.io", "europe-west3-docker.pkg.dev", "us-docker.pkg.dev"} {
+		if !isGCRRegistry(registry) {
+			t.Errorf("Expected '%s' to be a Google registry", registry)
+		}
+	}
+	for _, registry := range []string{"ghcr.io", "gcr.io.example.com", "docker.pkg.dev", "registry-1.docker.io"} {
+		if isGCRRegistry(registry) {
+			t.Errorf("Expected '%s' not to be a Google registry", registry)
+		}
+	}
+}
+
+func TestGetGCRCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"foo","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialsJSON, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "terraform@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		"token_uri":    server.URL,
+	})
+
+	username, password, err := getGCRCredentials(context.Background(), string(credentialsJSON))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if username != gcrAccessTokenUsername || password != "foo" {
+		t.Errorf("Expected the access token as credentials, but got '%s' and '%s'", username, password)
+	}
+
+	if _, _, err := getGCRCredentials(context.Background(), "{}"); err == nil {
+		t.Errorf("Expected an error for an invalid service account key")
+	}
+}
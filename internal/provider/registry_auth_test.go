@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthStrategyAuthorize(t *testing.T) {
+	authStrategies, err := registryAuthStrategies(map[string]string{
+		"ghcr.enterprise.example.com": "github",
+		"nexus.example.com":           "basic",
+		"token.example.com":           "bearer",
+		"ntlm.example.com":            "ntlm",
+	}, &ntlmAuthStrategy{username: "user", password: "pass", domain: "CORP"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	providerConfig := &ProviderConfig{AuthStrategies: authStrategies}
+	cases := []struct {
+		registry, username, password, expected string
+	}{
+		{"registry.example.com", "", "", ""},
+		{"registry.example.com", "user", "pass", "Basic dXNlcjpwYXNz"},
+		{"ghcr.io", "user", "pass", "Bearer cGFzcw=="},
+		{"ghcr.enterprise.example.com", "user", "pass", "Bearer cGFzcw=="},
+		{"nexus.example.com", "user", "pass", "Basic dXNlcjpwYXNz"},
+		{"token.example.com", "user", "token", "Bearer token"},
+		{"ntlm.example.com", "", "", "Basic Q09SUFx1c2VyOnBhc3M="},
+		{"gcr.io", gcrAccessTokenUsername, "token", "Bearer token"},
+		{"myregistry.azurecr.io", acrRefreshTokenUsername, "refresh", ""},
+		{"registry.example.com", identityTokenUsername, "refresh", ""},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", "https://"+c.registry+"/v2/", nil)
+		providerConfig.authStrategy(c.registry, c.username).Authorize(req, c.username, c.password)
+		if header := req.Header.Get("Authorization"); header != c.expected {
+			t.Errorf("Expected '%s' for %s, but got '%s'", c.expected, c.registry, header)
+		}
+	}
+
+	if _, err := registryAuthStrategies(map[string]string{"registry.example.com": "unknown"}, nil); err == nil {
+		t.Errorf("Expected an error for an unknown auth strategy")
+	}
+	if _, err := registryAuthStrategies(map[string]string{"registry.example.com": "ntlm"}, nil); err == nil {
+		t.Errorf("Expected an error for auth mode ntlm without NTLM credentials")
+	}
+	if _, err := (basicAuthStrategy{}).Token(context.Background(), nil, nil, "user", "pass", providerConfig); err == nil {
+		t.Errorf("Expected the basic auth mode not to answer bearer challenges")
+	}
+}
+
+func TestRegistryAuthModeHost(t *testing.T) {
+	cases := map[string]string{
+		"https://index.docker.io/v1/": "registry-1.docker.io",
+		"registry.example.com:5000":   "registry.example.com:5000",
+		// DevSkim: ignore DS137138
+		"http://localhost:5000": "localhost:5000",
+	}
+	for address, expected := range cases {
+		if host := registryAuthModeHost(address); host != expected {
+			t.Errorf("Expected host %s for %s, but got %s", expected, address, host)
+		}
+	}
+}
+
+// headerAuthStrategy authorizes requests with a static header and never answers challenges
+type headerAuthStrategy struct {
+	header string
+}
+
+func (s headerAuthStrategy) Authorize(req *http.Request, username, password string) {
+	req.Header.Set("X-Registry-Auth", s.header)
+}
+
+func (s headerAuthStrategy) Token(ctx context.Context, client *http.Client, challenge map[string]string, username, password string, providerConfig *ProviderConfig) (*TokenResponse, error) {
+	return &TokenResponse{Token: s.header}, nil
+}
+
+func TestGetImageDigest_authStrategy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Registry-Auth") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{AuthStrategies: map[string]AuthStrategy{registry: headerAuthStrategy{header: "secret"}}}
+	result, err := getImageDigest(context.Background(), registry, "foo", "latest", "", "", true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected the strategy of the registry to be used, but got %s", err)
+	}
+	if result.Digest != "sha256:foo" {
+		t.Errorf("Expected digest sha256:foo, but got %s", result.Digest)
+	}
+}
+
+func TestRegistryNTLMTransport(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("WWW-Authenticate", "NTLM")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	transport := registryNTLMTransport{hosts: map[string]bool{host: true}, transport: http.DefaultTransport}
+	req, _ := http.NewRequest("GET", server.URL+"/v2/", nil)
+	ntlmAuthStrategy{username: "user", password: "pass", domain: "CORP"}.Authorize(req, "", "")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	resp.Body.Close()
+
+	// anonymous first, then the negotiate message, the server does not send a challenge
+	if len(authorizations) != 2 || authorizations[0] != "" || !strings.HasPrefix(authorizations[1], "NTLM ") {
+		t.Errorf("Expected an anonymous request and an NTLM negotiation, but got %v", authorizations)
+	}
+
+	authorizations = nil
+	transport.hosts = map[string]bool{}
+	req, _ = http.NewRequest("GET", server.URL+"/v2/", nil)
+	req.SetBasicAuth("user", "pass")
+	resp, err = transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	resp.Body.Close()
+	if len(authorizations) != 1 || !strings.HasPrefix(authorizations[0], "Basic ") {
+		t.Errorf("Expected the request to another host to be sent as is, but got %v", authorizations)
+	}
+}
+
+func TestGetImageDigest_harborRobotAccount(t *testing.T) {
+	robot := "robot$project+ci"
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/service/token" {
+			if username, password, ok := r.BasicAuth(); !ok || username != robot || password != "secret" {
+				t.Errorf("Expected the robot credentials to survive the basic auth encoding, but got %s", username)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			scopes := r.URL.Query()["scope"]
+			if len(scopes) != 2 || scopes[0] != "repository:project/app:pull" || scopes[1] != "repository:project/base:pull" {
+				t.Errorf("Expected the scopes as separate parameters, but got %v", scopes)
+			}
+			fmt.Fprint(w, `{"token":"robot-token"}`)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer robot-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/service/token",service="harbor-registry",scope="repository:project/app:pull repository:project/base:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	// the robot account as stored by docker login in the auth field of the config file
+	configFile, err := loadConfigFile(strings.NewReader(`{"auths":{"` + registry + `":{"auth":"` + b64.StdEncoding.EncodeToString([]byte(robot+":secret")) + `"}}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	authConfig, err := configFile.GetAuthConfig(registry)
+	if err != nil || authConfig.Username != robot {
+		t.Fatalf("Expected the robot account from the config file, but got %s (%v)", authConfig.Username, err)
+	}
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	result, err := getImageDigest(context.Background(), registry, "project/app", "latest", authConfig.Username, authConfig.Password, true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result.Digest != "sha256:foo" {
+		t.Errorf("Expected digest sha256:foo, but got %s", result.Digest)
+	}
+}
+
+func TestGetImageDigest_quayRobotAccount(t *testing.T) {
+	robot := "org+ci"
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/auth" {
+			if username, password, ok := r.BasicAuth(); !ok || username != robot || password != "robot-secret" {
+				t.Errorf("Expected the robot credentials in the token request, but got %s", username)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			query := r.URL.Query()
+			if query.Get("service") != "quay.io" || query.Get("account") != robot || query.Get("scope") != "repository:org/app:pull" {
+				t.Errorf("Expected the token request of quay.io for the robot account, but got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"token":"quay-token"}`)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer quay-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/v2/auth",service="quay.io",scope="repository:org/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:quay")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	result, err := getImageDigest(context.Background(), registry, "org/app", "latest", robot, "robot-secret", true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result.Digest != "sha256:quay" {
+		t.Errorf("Expected digest sha256:quay, but got %s", result.Digest)
+	}
+}
@@ -0,0 +1,215 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// registryCopyEndpoint is a repository on a registry along with the credentials to access it
+type registryCopyEndpoint struct {
+	Registry   string
+	Repository string
+	Username   string
+	Password   string
+}
+
+// copyRegistryManifest copies the manifest reference refers to in src to dst, where it is stored under dstReference,
+// and returns its digest. The blobs of an image manifest and the manifests of a manifest list are copied first, as
+// registries reject manifests referencing content they do not have. Foreign layers are not copied.
+func copyRegistryManifest(ctx context.Context, client *http.Client, src, dst registryCopyEndpoint, reference, dstReference string, providerConfig *ProviderConfig) (string, error) {
+	rawManifest, err := getRawImageManifest(ctx, client, src.Registry, src.Repository, reference, src.Username, src.Password, false, providerConfig)
+	if err != nil {
+		return "", fmt.Errorf("Error reading the manifest %s: %w", reference, err)
+	}
+
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(rawManifest.Body, manifest); err != nil {
+		return "", fmt.Errorf("Error parsing the manifest %s: %s", reference, err)
+	}
+	// schema 1 manifests embed the repository and tag and are signed for them, registries reject them elsewhere
+	if manifestSchemaVersion(rawManifest.MediaType, false) == 1 || manifest.SchemaVersion == 1 {
+		return "", fmt.Errorf("The manifest %s is a schema 1 manifest, which cannot be copied. Push the image again with a current client to convert it to schema 2", reference)
+	}
+
+	if isManifestListMediaType(rawManifest.MediaType) {
+		for _, child := range manifest.Manifests {
+			if _, err := copyRegistryManifest(ctx, client, src, dst, child.Digest, child.Digest, providerConfig); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		blobs := append([]registryDescriptor{manifest.Config}, manifest.Layers...)
+		for _, blob := range blobs {
+			if blob.Digest == "" || blob.isForeign() {
+				continue
+			}
+			if err := copyRegistryBlob(ctx, client, src, dst, blob, providerConfig); err != nil {
+				return "", fmt.Errorf("Error copying the blob %s: %w", blob.Digest, err)
+			}
+		}
+	}
+
+	if err := putRegistryManifest(ctx, client, dst, dstReference, rawManifest, providerConfig); err != nil {
+		return "", fmt.Errorf("Error writing the manifest %s: %w", dstReference, err)
+	}
+	return rawManifest.Digest, nil
+}
+
+// copyRegistryBlob copies a blob unless the destination has it already. Within the same registry the blob is mounted
+// from the source repository, otherwise, or if the registry declines the mount, it is streamed from the source.
+func copyRegistryBlob(ctx context.Context, client *http.Client, src, dst registryCopyEndpoint, blob registryDescriptor, providerConfig *ProviderConfig) error {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	exists, err := registryBlobExists(ctx, client, dst, blob.Digest, providerConfig)
+	if err != nil || exists {
+		return err
+	}
+
+	uploadURL := registryURL(dst.Registry, providerConfig) + "/v2/" + dst.Repository + "/blobs/uploads/"
+	if src.Registry == dst.Registry {
+		uploadURL += "?" + url.Values{"mount": {blob.Digest}, "from": {src.Repository}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, nil)
+	if err != nil {
+		return fmt.Errorf("Error creating registry request: %s", err)
+	}
+	resp, err := doRegistryRequest(client, req, dst.Registry, dst.Username, dst.Password, providerConfig)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated {
+		log.Printf("[DEBUG] Mounted blob %s from %s into %s", blob.Digest, src.Repository, dst.Repository)
+		return nil
+	}
+
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("The registry did not return a valid upload location: %q", resp.Header.Get("Location"))
+	}
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	// a blob may take longer to transfer than a single registry request is allowed to, the transfer is only
+	// limited by the context, i.e. the create timeout of the resource
+	streamClient := *client
+	streamClient.Timeout = 0
+
+	// the blob is downloaded again for every attempt, e.g. after the registry asked for a token
+	openBlob := func() (io.ReadCloser, error) {
+		return &registryBlobReader{open: func() (io.ReadCloser, error) {
+			return getRegistryBlobStream(ctx, &streamClient, src, blob.Digest, providerConfig)
+		}}, nil
+	}
+	req, err = http.NewRequestWithContext(ctx, "PUT", location.String(), nil)
+	if err != nil {
+		return fmt.Errorf("Error creating registry request: %s", err)
+	}
+	req.Body, _ = openBlob()
+	req.GetBody = openBlob
+	req.ContentLength = blob.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// the blob is only sent once the registry accepted the credentials
+	req.Header.Set("Expect", "100-continue")
+
+	resp, err = doRegistryRequest(&streamClient, req, dst.Registry, dst.Username, dst.Password, providerConfig)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// registryBlobExists returns true if the repository has the blob already
+func registryBlobExists(ctx context.Context, client *http.Client, endpoint registryCopyEndpoint, digest string, providerConfig *ProviderConfig) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", registryURL(endpoint.Registry, providerConfig)+"/v2/"+endpoint.Repository+"/blobs/"+digest, nil)
+	if err != nil {
+		return false, fmt.Errorf("Error creating registry request: %s", err)
+	}
+	resp, err := doRegistryRequest(client, req, endpoint.Registry, endpoint.Username, endpoint.Password, providerConfig)
+	var responseErr *registryResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// getRegistryBlobStream opens the blob for reading, unlike getRegistryBlob it is not read into memory
+func getRegistryBlobStream(ctx context.Context, client *http.Client, endpoint registryCopyEndpoint, digest string, providerConfig *ProviderConfig) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(endpoint.Registry, providerConfig)+"/v2/"+endpoint.Repository+"/blobs/"+digest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+	resp, err := doRegistryRequest(client, req, endpoint.Registry, endpoint.Username, endpoint.Password, providerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the blob from the source: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// putRegistryManifest writes the manifest exactly as read, so that its digest stays the same
+func putRegistryManifest(ctx context.Context, client *http.Client, endpoint registryCopyEndpoint, reference string, manifest *registryRawManifest, providerConfig *ProviderConfig) error {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", registryURL(endpoint.Registry, providerConfig)+"/v2/"+endpoint.Repository+"/manifests/"+reference, bytes.NewReader(manifest.Body))
+	if err != nil {
+		return fmt.Errorf("Error creating registry request: %s", err)
+	}
+	req.Header.Set("Content-Type", manifest.MediaType)
+
+	resp, err := doRegistryRequest(client, req, endpoint.Registry, endpoint.Username, endpoint.Password, providerConfig)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" && digest != manifest.Digest {
+		return fmt.Errorf("The registry stored the manifest under the digest %s instead of %s", digest, manifest.Digest)
+	}
+	return nil
+}
+
+// registryBlobReader opens the blob on the first read, so that it is not downloaded if the request is rejected
+// before its body is sent
+type registryBlobReader struct {
+	open func() (io.ReadCloser, error)
+	body io.ReadCloser
+}
+
+func (r *registryBlobReader) Read(p []byte) (int, error) {
+	if r.body == nil {
+		body, err := r.open()
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	return r.body.Read(p)
+}
+
+func (r *registryBlobReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
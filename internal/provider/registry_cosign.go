@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// The annotation of a cosign signature layer holding the base64 encoded signature of the layer blob
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// Signature payloads are small JSON documents, larger blobs are not read
+const maxCosignPayloadSize = 1024 * 1024
+
+// cosignSimpleSigning is the payload signed by cosign, naming the digest of the signed manifest
+type cosignSimpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// parseCosignPublicKey parses a PEM encoded public key as written by cosign generate-key-pair
+func parseCosignPublicKey(pemKey string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("No PEM encoded public key found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the public key: %s", err)
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unsupported public key type %T", key)
+}
+
+// verifyCosignPayloadSignature verifies the signature over the payload, ECDSA and RSA signatures are made over its SHA-256 hash
+func verifyCosignPayloadSignature(key crypto.PublicKey, payload, signature []byte) error {
+	hash := sha256.Sum256(payload)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hash[:], signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported public key type %T", key)
+}
+
+// verifyCosignSignature checks that the manifest with the digest is signed with the key. The signatures are read
+// from the tag sha256-<hex>.sig, where cosign stores them next to the image. The transparency log is not checked.
+func verifyCosignSignature(ctx context.Context, registry, image, digest, username, password string, insecureSkipVerify bool, key crypto.PublicKey, providerConfig *ProviderConfig) error {
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+
+	signatureTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	signatures, err := getImageManifest(ctx, client, registry, image, signatureTag, username, password, providerConfig)
+	if isManifestNotFound(err) {
+		return fmt.Errorf("No cosign signature found for %s, the tag %s does not exist", digest, signatureTag)
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading the cosign signatures of %s: %s", digest, err)
+	}
+
+	lastErr := fmt.Errorf("The manifest %s does not contain cosign signatures", signatureTag)
+	for _, layer := range signatures.Layers {
+		signature, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		if err := verifyCosignSignatureLayer(ctx, client, registry, image, digest, username, password, layer, signature, key, providerConfig); err != nil {
+			lastErr = fmt.Errorf("The cosign signature %s is not valid: %s", layer.Digest, err)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// verifyCosignSignatureLayer verifies a single signature layer, whose blob is the signed payload naming the digest
+func verifyCosignSignatureLayer(ctx context.Context, client *http.Client, registry, image, digest, username, password string, layer registryDescriptor, signature string, key crypto.PublicKey, providerConfig *ProviderConfig) error {
+	rawSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("Error decoding the signature: %s", err)
+	}
+
+	payload, err := getRegistryBlob(ctx, client, registry, image, layer.Digest, username, password, providerConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyCosignPayloadSignature(key, payload, rawSignature); err != nil {
+		return err
+	}
+
+	simpleSigning := &cosignSimpleSigning{}
+	if err := json.Unmarshal(payload, simpleSigning); err != nil {
+		return fmt.Errorf("Error parsing the signed payload: %s", err)
+	}
+	if signed := simpleSigning.Critical.Image.DockerManifestDigest; signed != digest {
+		return fmt.Errorf("the payload is signed for %s", signed)
+	}
+	return nil
+}
+
+// getRegistryBlob reads a small blob like a signature payload and verifies that it matches its sha256 digest
+func getRegistryBlob(ctx context.Context, client *http.Client, registry, image, digest, username, password string, providerConfig *ProviderConfig) ([]byte, error) {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", registryURL(registry, providerConfig)+"/v2/"+image+"/blobs/"+digest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+
+	resp, err := doRegistryRequest(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCosignPayloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading registry response body: %s", err)
+	}
+	if len(body) > maxCosignPayloadSize {
+		return nil, fmt.Errorf("The blob %s is larger than %d bytes", digest, maxCosignPayloadSize)
+	}
+
+	hash := sha256.Sum256(body)
+	if computed := "sha256:" + hex.EncodeToString(hash[:]); computed != digest {
+		return nil, fmt.Errorf("The content of the blob %s does not match its digest", digest)
+	}
+	return body, nil
+}
@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func cosignTestPublicKey(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func cosignTestDigest(content []byte) string {
+	hash := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func TestDataSourceDockerRegistryImageRead_cosignSignature(t *testing.T) {
+	signingKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	imageDigest := cosignTestDigest(manifest)
+	blobs := map[string][]byte{}
+	signatureManifests := map[string]string{}
+	sign := func(tag string, signedDigest string) {
+		payload := []byte(`{"critical":{"identity":{"docker-reference":"registry/app"},"image":{"docker-manifest-digest":"` + signedDigest + `"},"type":"cosign container image signature"},"optional":null}`)
+		hash := sha256.Sum256(payload)
+		signature, _ := ecdsa.SignASN1(rand.Reader, signingKey, hash[:])
+		blobs[cosignTestDigest(payload)] = payload
+		signatureManifests[tag] = fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[`+
+			`{"mediaType":"application/vnd.dev.cosign.simplesigning.v1+json","digest":"%s","size":%d,"annotations":{"dev.cosignproject.cosign/signature":"%s"}}]}`,
+			cosignTestDigest(payload), len(payload), b64.StdEncoding.EncodeToString(signature))
+	}
+	sign("signed", imageDigest)
+	// a signature copied from another image
+	sign("copied", "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+
+	signatureTag := strings.Replace(imageDigest, ":", "-", 1) + ".sig"
+	current := "signed"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/app/manifests/1.0":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", imageDigest)
+			w.Write(manifest)
+		case r.URL.Path == "/v2/app/manifests/"+signatureTag && signatureManifests[current] != "":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			fmt.Fprint(w, signatureManifests[current])
+		case strings.HasPrefix(r.URL.Path, "/v2/app/blobs/") && blobs[strings.TrimPrefix(r.URL.Path, "/v2/app/blobs/")] != nil:
+			w.Write(blobs[strings.TrimPrefix(r.URL.Path, "/v2/app/blobs/")])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	read := func(publicKey string) (*schema.ResourceData, bool) {
+		d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryImage().Schema, map[string]interface{}{
+			"name":                 registry + "/app:1.0",
+			"insecure_skip_verify": true,
+			"cosign_public_key":    publicKey,
+		})
+		return d, dataSourceDockerRegistryImageRead(context.Background(), d, &ProviderConfig{AuthConfigs: &AuthConfigs{}}).HasError()
+	}
+
+	if d, failed := read(cosignTestPublicKey(t, &signingKey.PublicKey)); failed || d.Get("sha256_digest").(string) != imageDigest {
+		t.Errorf("Expected the signed image to be read, but got %s", d.Get("sha256_digest").(string))
+	}
+	if d, failed := read(cosignTestPublicKey(t, &otherKey.PublicKey)); !failed || d.Get("sha256_digest").(string) != "" {
+		t.Errorf("Expected the verification with another key to fail without setting the digest")
+	}
+
+	current = "copied"
+	if _, failed := read(cosignTestPublicKey(t, &signingKey.PublicKey)); !failed {
+		t.Errorf("Expected a signature of another digest to be rejected")
+	}
+
+	current = "missing"
+	if _, failed := read(cosignTestPublicKey(t, &signingKey.PublicKey)); !failed {
+		t.Errorf("Expected the verification to fail without signatures")
+	}
+}
+
+func TestVerifyCosignPayloadSignature_ed25519(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := parseCosignPublicKey(cosignTestPublicKey(t, publicKey))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+
+	payload := []byte(`{"critical":{}}`)
+	if err := verifyCosignPayloadSignature(key, payload, ed25519.Sign(privateKey, payload)); err != nil {
+		t.Errorf("Expected the signature to be valid, but got %s", err)
+	}
+	if err := verifyCosignPayloadSignature(key, []byte(`{}`), ed25519.Sign(privateKey, payload)); err == nil {
+		t.Errorf("Expected the signature of another payload to be invalid")
+	}
+
+	if _, err := parseCosignPublicKey("not a key"); err == nil {
+		t.Errorf("Expected an error for a value without a PEM block")
+	}
+}
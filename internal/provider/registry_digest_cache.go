@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registryDigestCache stores the digests tags were resolved to by the data sources for a short time, so that an
+// image referenced by several data sources, e.g. in modules, is only resolved once per Terraform operation.
+// A nil cache resolves the tag every time.
+type registryDigestCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*registryDigestCacheEntry
+}
+
+type registryDigestCacheEntry struct {
+	// done is closed once the tag was resolved, result, fallback, expiry and err are set before
+	done     chan struct{}
+	result   *imageDigestResult
+	fallback bool
+	expiry   time.Time
+	err      error
+}
+
+// newRegistryDigestCache returns a cache keeping digests for ttl, or nil if ttl is not positive
+func newRegistryDigestCache(ttl time.Duration) *registryDigestCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &registryDigestCache{
+		ttl:     ttl,
+		entries: make(map[string]*registryDigestCacheEntry),
+	}
+}
+
+// registryDigestCacheKey identifies a resolved reference by everything the result of the registry depends on. Like
+// for tokens, only a hash of the password is kept, a read with a wrong password must not get the digest of another.
+func registryDigestCacheKey(registry, repository, reference, username, password string, insecureSkipVerify bool, acceptMediaTypes []string) string {
+	insecure := "secure"
+	if insecureSkipVerify {
+		insecure = "insecure"
+	}
+	passwordHash := sha256.Sum256([]byte(password))
+	return strings.Join([]string{registry, repository, reference, username, hex.EncodeToString(passwordHash[:]), insecure, strings.Join(acceptMediaTypes, ",")}, "\x00")
+}
+
+// get returns the cached digest for key or resolves it with resolve. Concurrent calls for the same key
+// wait for the first resolve. Errors are returned to the waiting calls but are not cached.
+func (c *registryDigestCache) get(key string, resolve func() (*imageDigestResult, bool, error)) (*imageDigestResult, bool, error) {
+	if c == nil {
+		return resolve()
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		select {
+		case <-entry.done:
+			if entry.err != nil || time.Now().After(entry.expiry) {
+				ok = false
+			}
+		default:
+			// another read is resolving the tag right now
+		}
+	}
+	if !ok {
+		entry = &registryDigestCacheEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		entry.result, entry.fallback, entry.err = resolve()
+		entry.expiry = time.Now().Add(c.ttl)
+		close(entry.done)
+
+		return entry.result, entry.fallback, entry.err
+	}
+	c.mu.Unlock()
+
+	<-entry.done
+	return entry.result, entry.fallback, entry.err
+}
+
+// clear removes all digests, e.g. after a resource pushed or deleted an image and tags may point elsewhere
+func (c *registryDigestCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*registryDigestCacheEntry)
+}
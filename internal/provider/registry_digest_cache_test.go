@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestRegistryDigestCache(t *testing.T) {
+	cache := newRegistryDigestCache(time.Minute)
+	resolves := 0
+	resolve := func() (*imageDigestResult, bool, error) {
+		resolves++
+		return &imageDigestResult{Digest: "sha256:foo"}, true, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		result, fallback, err := cache.get("key", resolve)
+		if err != nil || result.Digest != "sha256:foo" || !fallback {
+			t.Fatalf("Expected the cached digest, but got %v, %t (%v)", result, fallback, err)
+		}
+	}
+	if resolves != 1 {
+		t.Errorf("Expected a single resolve, but got %d", resolves)
+	}
+
+	cache.clear()
+	cache.get("key", resolve)
+	if resolves != 2 {
+		t.Errorf("Expected the tag to be resolved again after clearing the cache, but got %d resolves", resolves)
+	}
+
+	failing := func() (*imageDigestResult, bool, error) {
+		resolves++
+		return nil, false, errors.New("registry down")
+	}
+	if _, _, err := cache.get("failing", failing); err == nil {
+		t.Errorf("Expected the error of the resolve")
+	}
+	cache.get("failing", failing)
+	if resolves != 4 {
+		t.Errorf("Expected errors not to be cached, but got %d resolves", resolves)
+	}
+
+	expiring := newRegistryDigestCache(time.Nanosecond)
+	expiring.get("key", resolve)
+	time.Sleep(time.Millisecond)
+	expiring.get("key", resolve)
+	if resolves != 6 {
+		t.Errorf("Expected the expired digest to be resolved again, but got %d resolves", resolves)
+	}
+
+	// a ttl of 0 disables the cache
+	disabled := newRegistryDigestCache(0)
+	disabled.get("key", resolve)
+	disabled.get("key", resolve)
+	disabled.clear()
+	if resolves != 8 {
+		t.Errorf("Expected every read to resolve the tag without a cache, but got %d resolves", resolves)
+	}
+}
+
+func TestRegistryDigestCache_concurrent(t *testing.T) {
+	cache := newRegistryDigestCache(time.Minute)
+	var resolves int32
+	release := make(chan struct{})
+	resolve := func() (*imageDigestResult, bool, error) {
+		atomic.AddInt32(&resolves, 1)
+		<-release
+		return &imageDigestResult{Digest: "sha256:foo"}, false, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result, _, err := cache.get("key", resolve); err != nil || result.Digest != "sha256:foo" {
+				t.Errorf("Expected the digest, but got %v (%v)", result, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if resolves != 1 {
+		t.Errorf("Expected concurrent reads to share a single resolve, but got %d", resolves)
+	}
+}
+
+func TestDataSourceDockerRegistryImageRead_cachedDigest(t *testing.T) {
+	var manifestRequests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/app/manifests/1.0" {
+			atomic.AddInt32(&manifestRequests, 1)
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+		w.Write([]byte(`{"schemaVersion":2}`))
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}, RegistryDigests: newRegistryDigestCache(time.Minute)}
+	read := func(name string, insecureSkipVerify bool) {
+		d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryImage().Schema, map[string]interface{}{
+			"name":                 name,
+			"insecure_skip_verify": insecureSkipVerify,
+		})
+		if diags := dataSourceDockerRegistryImageRead(context.Background(), d, providerConfig); diags.HasError() {
+			t.Fatalf("Expected no error, but got %v", diags)
+		}
+		if digest := d.Get("sha256_digest").(string); digest != "sha256:foo" {
+			t.Errorf("Expected digest sha256:foo, but got %s", digest)
+		}
+	}
+
+	read(registry+"/app:1.0", true)
+	read(registry+"/app:1.0", true)
+	if manifestRequests != 1 {
+		t.Errorf("Expected the tag to be resolved once, but got %d requests", manifestRequests)
+	}
+
+	// a read verifying the certificate must not reuse the result of an insecure read
+	providerConfig.RegistryRootCAs = x509.NewCertPool()
+	providerConfig.RegistryRootCAs.AddCert(server.Certificate())
+	read(registry+"/app:1.0", false)
+	if manifestRequests != 2 {
+		t.Errorf("Expected the tag to be resolved again with other TLS settings, but got %d requests", manifestRequests)
+	}
+}
+
+func TestDataSourceDockerRegistryImageRead_cachedDigestOtherPassword(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+		w.Write([]byte(`{"schemaVersion":2}`))
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}, RegistryDigests: newRegistryDigestCache(time.Minute)}
+	read := func(password string) diag.Diagnostics {
+		d := schema.TestResourceDataRaw(t, dataSourceDockerRegistryImage().Schema, map[string]interface{}{
+			"name":                 registry + "/app:1.0",
+			"username":             "user",
+			"password":             password,
+			"insecure_skip_verify": true,
+		})
+		return dataSourceDockerRegistryImageRead(context.Background(), d, providerConfig)
+	}
+
+	if diags := read("valid"); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	// the digest of the first read is still cached, but must not be returned for another password
+	if diags := read("invalid"); !diags.HasError() {
+		t.Error("Expected the invalid password to be rejected by the registry")
+	}
+}
@@ -0,0 +1,33 @@
+package provider
+
+import "context"
+
+// registryRequestLimiter bounds the number of registry operations running at the same time across all
+// data sources and resources of the provider. A nil limiter does not limit anything.
+type registryRequestLimiter struct {
+	slots chan struct{}
+}
+
+// newRegistryRequestLimiter returns a limiter allowing max concurrent operations, or nil if max is not positive
+func newRegistryRequestLimiter(max int) *registryRequestLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &registryRequestLimiter{
+		slots: make(chan struct{}, max),
+	}
+}
+
+// acquire blocks until a slot is free and returns the function releasing it, or the error of ctx if it is done
+// before. Operations must not acquire a second slot while holding one, otherwise concurrent reads can deadlock.
+func (l *registryRequestLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistryRequestLimiter(t *testing.T) {
+	limiter := newRegistryRequestLimiter(2)
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.acquire(context.Background())
+			if err != nil {
+				t.Errorf("Expected no error, but got %s", err)
+				return
+			}
+			defer release()
+
+			current := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning != 2 {
+		t.Errorf("Expected at most 2 concurrent operations, but got %d", maxRunning)
+	}
+
+	var unlimited *registryRequestLimiter
+	if release, err := unlimited.acquire(context.Background()); err != nil {
+		t.Errorf("Expected no error without a limiter, but got %s", err)
+	} else {
+		release()
+	}
+	if newRegistryRequestLimiter(0) != nil {
+		t.Errorf("Expected no limiter without a positive maximum")
+	}
+}
+
+func TestRegistryRequestLimiter_cancelled(t *testing.T) {
+	limiter := newRegistryRequestLimiter(1)
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := limiter.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected waiting for a slot to be cancelled, but got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry-After values above this are not waited for, the response is returned as is instead
+const registryMaxRetryAfter = time.Minute
+
+// doRegistryRequestWithRetry sends the request and retries it with exponential backoff as long as
+// the registry answers with 429 Too Many Requests or a 5xx status. A Retry-After header takes
+// precedence over the computed backoff. The request is given up as soon as its context is done, also while waiting
+// for a retry.
+func doRegistryRequestWithRetry(client *http.Client, req *http.Request, providerConfig *ProviderConfig) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		// the body of the previous attempt was consumed already
+		if attempt > 0 {
+			if err := resetRegistryRequestBody(req); err != nil {
+				return nil, err
+			}
+		}
+
+		providerConfig.RegistryStats.countRequest(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			// a cancelled or timed out Terraform operation is not a timeout of the registry
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				return nil, fmt.Errorf("Registry request to %s was cancelled: %w", req.URL.Host, ctxErr)
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, fmt.Errorf("Timeout after %s waiting for registry %s: %s", client.Timeout, req.URL.Host, err)
+			}
+			return nil, fmt.Errorf("Error during registry request: %s", err)
+		}
+
+		if !isRetryableStatus(resp.StatusCode) || attempt >= providerConfig.RegistryMaxRetries {
+			decodeRegistryResponseBody(resp)
+			return resp, nil
+		}
+
+		delay := retryBackoff(providerConfig.RegistryRetryDelay, attempt)
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if retryAfter > registryMaxRetryAfter {
+				decodeRegistryResponseBody(resp)
+				return resp, nil
+			}
+			delay = retryAfter
+		}
+
+		// drain the body so the connection can be reused
+		io.Copy(ioutil.Discard, resp.Body) //nolint:errcheck
+		resp.Body.Close()
+
+		providerConfig.RegistryStats.countRetry()
+		log.Printf("[DEBUG] Got %s from %s, retrying in %s (%d/%d)", resp.Status, redactRegistryURL(req.URL), delay, attempt+1, providerConfig.RegistryMaxRetries)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, fmt.Errorf("Registry request to %s was cancelled: %w", req.URL.Host, req.Context().Err())
+		}
+	}
+}
+
+// decodeRegistryResponseBody decompresses a gzip encoded body the transport did not decompress itself. The transport
+// only does so if it asked for gzip, but some registries and proxies compress manifests unasked, which would
+// otherwise be hashed compressed when the digest is computed from the body.
+func decodeRegistryResponseBody(resp *http.Response) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+
+	resp.Body = &gzipResponseBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// gzipResponseBody decompresses the body on the first read, so that empty bodies, e.g. of errors, can still be closed
+type gzipResponseBody struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+	err    error
+}
+
+func (b *gzipResponseBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *gzipResponseBody) Close() error {
+	return b.body.Close()
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryBackoff doubles the base delay with every attempt and picks a random delay
+// in the upper half of it, so that parallel reads do not retry in lockstep
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	backoff := base << uint(attempt)
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses the Retry-After header which is either a number of seconds or an HTTP date
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// resetRegistryRequestBody replaces the body of a request which was sent already, e.g. without credentials before the
+// registry asked for a token. Requests without GetBody have no body or cannot be sent again.
+func resetRegistryRequestBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return fmt.Errorf("Error resetting the request body: %s", err)
+	}
+	req.Body = body
+	return nil
+}
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoRegistryRequestWithRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	providerConfig := &ProviderConfig{RegistryMaxRetries: 3, RegistryRetryDelay: time.Millisecond}
+	resp, err := doRegistryRequestWithRetry(http.DefaultClient, req, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || requests != 3 {
+		t.Errorf("Expected 200 after 3 requests, but got %d after %d requests", resp.StatusCode, requests)
+	}
+
+	requests = 0
+	providerConfig.RegistryMaxRetries = 1
+	resp, _ = doRegistryRequestWithRetry(http.DefaultClient, req, providerConfig)
+	if resp.StatusCode != http.StatusTooManyRequests || requests != 2 {
+		t.Errorf("Expected the last response after exhausting the retries, but got %d after %d requests", resp.StatusCode, requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	if delay, ok := parseRetryAfter("120", now); !ok || delay != 2*time.Minute {
+		t.Errorf("Expected 2m for seconds, but got %s (%t)", delay, ok)
+	}
+	if delay, ok := parseRetryAfter("Fri, 01 Jul 2022 12:00:30 GMT", now); !ok || delay != 30*time.Second {
+		t.Errorf("Expected 30s for an HTTP date, but got %s (%t)", delay, ok)
+	}
+	if delay, ok := parseRetryAfter("Fri, 01 Jul 2022 11:00:00 GMT", now); !ok || delay != 0 {
+		t.Errorf("Expected no delay for a date in the past, but got %s (%t)", delay, ok)
+	}
+	for _, header := range []string{"", "-1", "soon"} {
+		if _, ok := parseRetryAfter(header, now); ok {
+			t.Errorf("Expected '%s' to be ignored", header)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempt := 0; attempt < 4; attempt++ {
+		max := time.Second << uint(attempt)
+		if delay := retryBackoff(time.Second, attempt); delay < max/2 || delay > max {
+			t.Errorf("Expected the delay of attempt %d to be between %s and %s, but was %s", attempt, max/2, max, delay)
+		}
+	}
+	if delay := retryBackoff(0, 2); delay != 0 {
+		t.Errorf("Expected no delay without a base delay, but was %s", delay)
+	}
+}
+
+func TestDoRegistryRequestWithRetry_resetsBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("grant_type=refresh_token"))
+	providerConfig := &ProviderConfig{RegistryMaxRetries: 1}
+	if _, err := doRegistryRequestWithRetry(http.DefaultClient, req, providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if len(bodies) != 2 || bodies[1] != "grant_type=refresh_token" {
+		t.Errorf("Expected the body to be sent again on retry, but got %q", bodies)
+	}
+}
+
+func TestDoRegistryRequestWithRetry_timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	providerConfig := &ProviderConfig{RegistryTimeout: 50 * time.Millisecond}
+	client := newRegistryHTTPClient(providerConfig, false)
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	_, err := doRegistryRequestWithRetry(client, req, providerConfig)
+	if err == nil || !strings.Contains(err.Error(), "Timeout after 50ms waiting for registry "+req.URL.Host) {
+		t.Errorf("Expected a timeout error naming the registry, but got %v", err)
+	}
+}
+
+func TestDoRegistryRequestWithRetry_cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	providerConfig := &ProviderConfig{RegistryMaxRetries: 3}
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	start := time.Now()
+	_, err := doRegistryRequestWithRetry(http.DefaultClient, req, providerConfig)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the request to be cancelled, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the retry to be given up once cancelled, but it took %s", elapsed)
+	}
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// registryStats counts the registry calls of all data sources and resources of the provider, e.g. to measure the
+// effect of the caches and the concurrency limit. A nil stats does not count anything.
+type registryStats struct {
+	requests         int64
+	manifestRequests int64
+	tokenExchanges   int64
+	tokenCacheHits   int64
+	digestCacheHits  int64
+	retries          int64
+}
+
+// countRequest counts a request sent to a registry or token server, every retry is counted as request as well
+func (s *registryStats) countRequest(req *http.Request) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.requests, 1)
+	if strings.Contains(req.URL.Path, "/manifests/") {
+		atomic.AddInt64(&s.manifestRequests, 1)
+	}
+}
+
+// countTokenExchange counts a token requested with the credentials or refresh token of a registry
+func (s *registryStats) countTokenExchange() {
+	if s != nil {
+		atomic.AddInt64(&s.tokenExchanges, 1)
+	}
+}
+
+// countTokenCacheHit counts a token taken from the token cache instead of exchanging the credentials
+func (s *registryStats) countTokenCacheHit() {
+	if s != nil {
+		atomic.AddInt64(&s.tokenCacheHits, 1)
+	}
+}
+
+// countDigestCacheHit counts a digest taken from the digest cache instead of requesting the manifest
+func (s *registryStats) countDigestCacheHit() {
+	if s != nil {
+		atomic.AddInt64(&s.digestCacheHits, 1)
+	}
+}
+
+// countRetry counts a request retried after a 429 or 5xx response
+func (s *registryStats) countRetry() {
+	if s != nil {
+		atomic.AddInt64(&s.retries, 1)
+	}
+}
+
+// snapshot returns the current counts keyed by the attribute names of the docker_registry_stats data source
+func (s *registryStats) snapshot() map[string]int {
+	if s == nil {
+		s = &registryStats{}
+	}
+	return map[string]int{
+		"requests":          int(atomic.LoadInt64(&s.requests)),
+		"manifest_requests": int(atomic.LoadInt64(&s.manifestRequests)),
+		"token_exchanges":   int(atomic.LoadInt64(&s.tokenExchanges)),
+		"token_cache_hits":  int(atomic.LoadInt64(&s.tokenCacheHits)),
+		"digest_cache_hits": int(atomic.LoadInt64(&s.digestCacheHits)),
+		"retries":           int(atomic.LoadInt64(&s.retries)),
+	}
+}
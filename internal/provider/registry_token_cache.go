@@ -0,0 +1,217 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The distribution spec defines 60 seconds as the token lifetime if the token server does not return one
+const defaultRegistryTokenExpiresIn = 60
+
+// Tokens are renewed this long before they expire to account for clock skew and request durations
+const registryTokenExpiryMargin = 10 * time.Second
+
+// registryTokenCache stores bearer tokens obtained from registry token servers so that
+// several reads against the same registry and scope only perform a single token exchange.
+// A nil cache is valid and fetches a new token every time.
+type registryTokenCache struct {
+	mu      sync.Mutex
+	entries map[string]*registryTokenCacheEntry
+	// refreshTokens are issued by token servers for offline access, keyed by registry and user
+	refreshTokens map[string]string
+}
+
+type registryTokenCacheEntry struct {
+	// done is closed once the token request finished, grant, expiry and err are set before
+	done   chan struct{}
+	grant  registryTokenGrant
+	expiry time.Time
+	err    error
+}
+
+// registryTokenGrant is a bearer token along with what the token server stated about it
+type registryTokenGrant struct {
+	token string
+	// scope is the scope granted by the token server, empty if it cannot be told from the token response
+	scope string
+	// expiresIn is the lifetime of the token in seconds as returned by the token server, 0 if none was returned
+	expiresIn int
+}
+
+func newRegistryTokenCache() *registryTokenCache {
+	return &registryTokenCache{
+		entries:       make(map[string]*registryTokenCacheEntry),
+		refreshTokens: make(map[string]string),
+	}
+}
+
+// registryTokenCacheKey identifies a token by the challenge it answers and the credentials it was issued to. Only a hash
+// of the password or identity token is kept, reads with another password for the same user must not share the token.
+func registryTokenCacheKey(realm, service, scope, username, password string) string {
+	passwordHash := sha256.Sum256([]byte(password))
+	return strings.Join([]string{realm, service, scope, username, hex.EncodeToString(passwordHash[:])}, "\x00")
+}
+
+// get returns the cached token for key or obtains a new one with fetch. Concurrent calls for the
+// same key wait for the first fetch instead of requesting a token themselves.
+func (c *registryTokenCache) get(key string, fetch func() (*TokenResponse, error)) (string, error) {
+	grant, err := c.getGrant(key, fetch)
+	return grant.token, err
+}
+
+// getGrant is like get, but returns the scope and lifetime of the token as well
+func (c *registryTokenCache) getGrant(key string, fetch func() (*TokenResponse, error)) (registryTokenGrant, error) {
+	if c == nil {
+		token, err := fetch()
+		if err != nil {
+			return registryTokenGrant{}, err
+		}
+		return token.grant(), nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		select {
+		case <-entry.done:
+			if entry.err != nil || time.Now().After(entry.expiry) {
+				ok = false
+			}
+		default:
+			// another read is fetching the token right now
+		}
+	}
+	if !ok {
+		entry = &registryTokenCacheEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		token, err := fetch()
+		if err != nil {
+			entry.err = err
+		} else {
+			entry.grant = token.grant()
+			entry.expiry = token.expiry(time.Now())
+		}
+		close(entry.done)
+
+		return entry.grant, entry.err
+	}
+	c.mu.Unlock()
+
+	<-entry.done
+	return entry.grant, entry.err
+}
+
+// invalidate removes the token for key, e.g. after the registry rejected it before its expiry
+func (c *registryTokenCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		select {
+		case <-entry.done:
+			delete(c.entries, key)
+		default:
+			// a new token is being fetched already
+		}
+	}
+}
+
+// refreshToken returns the refresh token issued for the user by the token server of the registry, if any
+func (c *registryTokenCache) refreshToken(registry, username string) string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshTokens[registry+"\x00"+username]
+}
+
+// setRefreshToken stores the refresh token issued for the user by the token server of the registry
+func (c *registryTokenCache) setRefreshToken(registry, username, refreshToken string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshTokens[registry+"\x00"+username] = refreshToken
+}
+
+// bearerToken returns the token to send in the Authorization header, token servers may use either field
+func (t *TokenResponse) bearerToken() string {
+	if t.Token != "" {
+		return t.Token
+	}
+	return t.AccessToken
+}
+
+// grant returns the bearer token along with its granted scope and lifetime
+func (t *TokenResponse) grant() registryTokenGrant {
+	return registryTokenGrant{
+		token:     t.bearerToken(),
+		scope:     t.grantedScope(),
+		expiresIn: t.ExpiresIn,
+	}
+}
+
+// grantedScope returns the scope returned by OAuth2 token servers. Docker distribution token servers do not
+// return it, but issue JWTs listing the granted actions in the access claim, which is read without verifying
+// the token. The registry verifies it anyway, the scope is only informational.
+func (t *TokenResponse) grantedScope() string {
+	if t.Scope != "" {
+		return t.Scope
+	}
+
+	parts := strings.Split(t.bearerToken(), ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	claims := struct {
+		Access []struct {
+			Type    string   `json:"type"`
+			Name    string   `json:"name"`
+			Actions []string `json:"actions"`
+		} `json:"access"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	scopes := make([]string, 0, len(claims.Access))
+	for _, access := range claims.Access {
+		scopes = append(scopes, access.Type+":"+access.Name+":"+strings.Join(access.Actions, ","))
+	}
+	return strings.Join(scopes, " ")
+}
+
+// expiry returns the point in time after which the token should no longer be used
+func (t *TokenResponse) expiry(now time.Time) time.Time {
+	issuedAt := now
+	if t.IssuedAt != "" {
+		if parsed, err := time.Parse(time.RFC3339, t.IssuedAt); err == nil {
+			issuedAt = parsed
+		}
+	}
+
+	expiresIn := t.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = defaultRegistryTokenExpiresIn
+	}
+
+	return issuedAt.Add(time.Duration(expiresIn)*time.Second - registryTokenExpiryMargin)
+}
@@ -0,0 +1,287 @@
+package provider
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistryTokenCache_reuse(t *testing.T) {
+	cache := newRegistryTokenCache()
+	fetches := 0
+	fetch := func() (*TokenResponse, error) {
+		fetches++
+		return &TokenResponse{Token: "foo", ExpiresIn: 300}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		token, err := cache.get("key", fetch)
+		if err != nil || token != "foo" {
+			t.Fatalf("Expected token foo, but got '%s' (%v)", token, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected a single token request, but got %d", fetches)
+	}
+
+	if _, err := cache.get("other", fetch); err != nil || fetches != 2 {
+		t.Errorf("Expected a new token request for a different key, but got %d requests (%v)", fetches, err)
+	}
+}
+
+func TestRegistryTokenCache_expiredAndFailed(t *testing.T) {
+	cache := newRegistryTokenCache()
+	fetches := 0
+
+	// tokens expiring within the safety margin are never reused
+	expired := func() (*TokenResponse, error) {
+		fetches++
+		return &TokenResponse{AccessToken: "bar", ExpiresIn: 5}, nil
+	}
+	cache.get("key", expired)
+	if token, _ := cache.get("key", expired); token != "bar" || fetches != 2 {
+		t.Errorf("Expected the expired token to be requested again, but got %d requests", fetches)
+	}
+
+	failing := func() (*TokenResponse, error) {
+		fetches++
+		return nil, errors.New("token server down")
+	}
+	if _, err := cache.get("failing", failing); err == nil {
+		t.Errorf("Expected the error of the token request")
+	}
+	cache.get("failing", failing)
+	if fetches != 4 {
+		t.Errorf("Expected failed token requests not to be cached, but got %d requests", fetches)
+	}
+}
+
+func TestRegistryTokenCache_concurrent(t *testing.T) {
+	cache := newRegistryTokenCache()
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func() (*TokenResponse, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &TokenResponse{Token: "foo"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := cache.get("key", fetch); err != nil || token != "foo" {
+				t.Errorf("Expected token foo, but got '%s' (%v)", token, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("Expected concurrent reads to share a single token request, but got %d", fetches)
+	}
+}
+
+func TestDoRegistryRequest_refreshToken(t *testing.T) {
+	validToken := "first"
+	refreshRequests := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" && r.Method == "GET" {
+			if r.URL.Query().Get("offline_token") != "true" || r.URL.Query().Get("client_id") == "" {
+				t.Errorf("Expected a refresh token to be requested, but got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"token":"first","expires_in":300,"refresh_token":"refresh"}`)
+			return
+		}
+		if r.URL.Path == "/token" {
+			refreshRequests++
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "refresh" {
+				t.Errorf("Expected the refresh token grant, but got %v", r.PostForm)
+			}
+			fmt.Fprint(w, `{"access_token":"second","expires_in":300}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	if _, err := getImageDigest(context.Background(), registry, "app", "latest", "user", "pass", true, false, providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if refreshToken := providerConfig.RegistryTokens.refreshToken(registry, "user"); refreshToken != "refresh" {
+		t.Errorf("Expected the refresh token to be stored for the registry, but got '%s'", refreshToken)
+	}
+
+	// the registry revokes the cached token before it expires
+	validToken = "second"
+	if _, err := getImageDigest(context.Background(), registry, "app", "latest", "user", "pass", true, false, providerConfig); err != nil {
+		t.Fatalf("Expected the token to be refreshed, but got %s", err)
+	}
+	if refreshRequests != 1 {
+		t.Errorf("Expected a single refresh, but got %d", refreshRequests)
+	}
+}
+
+func TestDoRegistryRequest_tokenPerPassword(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if _, password, _ := r.BasicAuth(); password != "valid" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"foo"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	if _, err := getImageDigest(context.Background(), registry, "app", "latest", "user", "valid", true, false, providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	// the same user with another password must not be answered with the cached token
+	if _, err := getImageDigest(context.Background(), registry, "app", "latest", "user", "invalid", true, false, providerConfig); err == nil {
+		t.Error("Expected the invalid password to be rejected by the token server")
+	}
+}
+
+func TestDoRegistryRequest_reexchangeToken(t *testing.T) {
+	tokenRequests := 0
+	authenticatedRequests := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			fmt.Fprintf(w, `{"token":"token-%d","expires_in":300}`, tokenRequests)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// the first token expired before the manifest request reached the registry
+		authenticatedRequests++
+		if authenticatedRequests == 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:app:pull",error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			t.Errorf("Expected the re-exchanged token on the retry, but got %s", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	result, err := getImageDigest(context.Background(), registry, "app", "latest", "user", "pass", true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected the token to be re-exchanged, but got %s", err)
+	}
+	if result.Digest != "sha256:foo" {
+		t.Errorf("Expected digest sha256:foo, but got %s", result.Digest)
+	}
+	if tokenRequests != 2 || authenticatedRequests != 2 {
+		t.Errorf("Expected a single re-exchange and retry, but got %d token and %d authenticated requests", tokenRequests, authenticatedRequests)
+	}
+}
+
+func TestTokenResponseExpiry(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	token := &TokenResponse{}
+	if expiry := token.expiry(now); !expiry.Equal(now.Add(50 * time.Second)) {
+		t.Errorf("Expected the default lifetime of 60s minus margin, but expiry was %s", expiry)
+	}
+
+	token = &TokenResponse{ExpiresIn: 300, IssuedAt: "2022-07-01T11:59:00Z"}
+	if expiry := token.expiry(now); !expiry.Equal(now.Add(230 * time.Second)) {
+		t.Errorf("Expected expiry relative to issued_at, but expiry was %s", expiry)
+	}
+}
+
+func TestTokenResponse_grantedScope(t *testing.T) {
+	claims := b64.RawURLEncoding.EncodeToString([]byte(`{"access":[{"type":"repository","name":"owner/app","actions":["pull","push"]}]}`))
+	cases := []struct {
+		token    TokenResponse
+		expected string
+	}{
+		{TokenResponse{AccessToken: "opaque", Scope: "repository:owner/app:pull"}, "repository:owner/app:pull"},
+		{TokenResponse{Token: "header." + claims + ".signature"}, "repository:owner/app:pull,push"},
+		{TokenResponse{Token: "header.not-json.signature"}, ""},
+		{TokenResponse{Token: "opaque"}, ""},
+	}
+
+	for _, c := range cases {
+		if scope := c.token.grantedScope(); scope != c.expected {
+			t.Errorf("Expected scope '%s' for %+v, but got '%s'", c.expected, c.token, scope)
+		}
+	}
+}
+
+func TestGetImageDigest_tokenGrant(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token":"foo","scope":"repository:owner/app:pull","expires_in":300}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:owner/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTokens: newRegistryTokenCache()}
+	result, err := getImageDigest(context.Background(), registry, "owner/app", "latest", "user", "secret", true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result.GrantedScope != "repository:owner/app:pull" || result.TokenExpiresIn != 300 {
+		t.Errorf("Expected the scope and lifetime of the token, but got '%s' and %d", result.GrantedScope, result.TokenExpiresIn)
+	}
+
+	// the cached token is described the same way
+	result, err = getImageDigest(context.Background(), registry, "owner/app", "latest", "user", "secret", true, false, providerConfig)
+	if err != nil || result.GrantedScope != "repository:owner/app:pull" {
+		t.Errorf("Expected the scope of the cached token, but got '%s' (%v)", result.GrantedScope, err)
+	}
+
+	result, err = getImageDigest(context.Background(), registry, "owner/app", "latest", "", "", true, false, providerConfig)
+	if err != nil || result.GrantedScope != "" || result.TokenExpiresIn != 0 {
+		t.Errorf("Expected no grant for an anonymous read, but got '%s' and %d (%v)", result.GrantedScope, result.TokenExpiresIn, err)
+	}
+}
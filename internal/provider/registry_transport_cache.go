@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// tlsVersions maps the values of tls_min_version to the TLS versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// registryTransportKey identifies the TLS settings a transport was created with. All other settings
+// are taken from the provider configuration and are the same for every transport.
+type registryTransportKey struct {
+	insecureSkipVerify bool
+}
+
+// registryTransportCache shares transports between the reads of all data sources and resources, so that
+// connections and TLS sessions to a registry are reused. A nil cache creates a new transport every time.
+type registryTransportCache struct {
+	mu         sync.Mutex
+	transports map[registryTransportKey]*http.Transport
+}
+
+func newRegistryTransportCache() *registryTransportCache {
+	return &registryTransportCache{
+		transports: make(map[registryTransportKey]*http.Transport),
+	}
+}
+
+// get returns the transport for key, creating it with create on first use
+func (c *registryTransportCache) get(key registryTransportKey, create func() *http.Transport) *http.Transport {
+	if c == nil {
+		return create()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transport, ok := c.transports[key]
+	if !ok {
+		transport = create()
+		c.transports[key] = transport
+	}
+	return transport
+}
+
+// newRegistryTransport returns a transport with the TLS and proxy settings of the provider for registry requests
+func newRegistryTransport(providerConfig *ProviderConfig, key registryTransportKey) *http.Transport {
+	minVersion := providerConfig.RegistryTLSMinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	transport := defaultPooledTransport()
+	// a custom TLS config disables HTTP/2 unless it is requested explicitly
+	transport.ForceAttemptHTTP2 = true
+	// DevSkim: ignore DS440000
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         minVersion,
+		InsecureSkipVerify: key.insecureSkipVerify,
+		RootCAs:            providerConfig.RegistryRootCAs,
+		Certificates:       providerConfig.RegistryClientCertificates,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+	if providerConfig.RegistryProxyURL != nil {
+		transport.Proxy = http.ProxyURL(providerConfig.RegistryProxyURL)
+	}
+	if len(providerConfig.RegistryUnixSockets) > 0 {
+		dial := transport.DialContext
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if socket, ok := registryUnixSocket(providerConfig.RegistryUnixSockets, addr); ok {
+				return dial(ctx, "unix", socket)
+			}
+			return dial(ctx, network, addr)
+		}
+	}
+	// the TLS handshake is only taken over if needed, so that the transport behaves as usual otherwise
+	if len(providerConfig.RegistryTLSOverrides) > 0 {
+		dial := transport.DialContext
+		transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// the config carries the protocols the transport added for HTTP/2 by now
+			config := transport.TLSClientConfig.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+			if override, ok := registryTLSOverrideFor(providerConfig.RegistryTLSOverrides, addr); ok {
+				override.apply(config)
+			}
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+	}
+	return transport
+}
+
+// registryTLSOverride changes the TLS settings of the connections to a registry, e.g. behind a legacy load balancer
+type registryTLSOverride struct {
+	// serverName is sent as SNI and verified against the certificate instead of the host, if not empty
+	serverName string
+	// renegotiation allows the registry to renegotiate the TLS session once per connection
+	renegotiation bool
+}
+
+func (o registryTLSOverride) apply(config *tls.Config) {
+	if o.serverName != "" {
+		config.ServerName = o.serverName
+	}
+	if o.renegotiation {
+		config.Renegotiation = tls.RenegotiateOnceAsClient
+	}
+}
+
+// registryUnixSocket returns the Unix socket configured for the host of the dialed address
+func registryUnixSocket(sockets map[string]string, addr string) (string, bool) {
+	for _, host := range registryDialHosts(addr) {
+		if socket, ok := sockets[host]; ok {
+			return socket, true
+		}
+	}
+	return "", false
+}
+
+// registryTLSOverrideFor returns the TLS settings configured for the host of the dialed address
+func registryTLSOverrideFor(overrides map[string]registryTLSOverride, addr string) (registryTLSOverride, bool) {
+	for _, host := range registryDialHosts(addr) {
+		if override, ok := overrides[host]; ok {
+			return override, true
+		}
+	}
+	return registryTLSOverride{}, false
+}
+
+// registryDialHosts returns the keys the settings of a dialed address are looked up with, the address and its host
+// without the port, so that a setting configured for `registry.local` applies to any port
+func registryDialHosts(addr string) []string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []string{addr}
+	}
+	return []string{addr, host}
+}
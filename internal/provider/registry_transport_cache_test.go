@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newCountingRegistryServer returns a TLS registry serving a digest for every manifest and counting the connections opened to it
+func newCountingRegistryServer() (*httptest.Server, *int32) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.StartTLS()
+	return server, &connections
+}
+
+func readImageDigests(registry string, count int, providerConfig *ProviderConfig) error {
+	for i := 0; i < count; i++ {
+		if _, err := getImageDigest(context.Background(), registry, fmt.Sprintf("app%d", i), "latest", "", "", true, false, providerConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRegistryTransportCache(t *testing.T) {
+	server, connections := newCountingRegistryServer()
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	providerConfig := &ProviderConfig{RegistryTransports: newRegistryTransportCache()}
+	if err := readImageDigests(registry, 50, providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *connections != 1 {
+		t.Errorf("Expected a single connection for all reads, but got %d", *connections)
+	}
+
+	insecureClient := newRegistryHTTPClient(providerConfig, true)
+	secureClient := newRegistryHTTPClient(providerConfig, false)
+	if insecureClient.Transport == secureClient.Transport {
+		t.Errorf("Expected different transports for different TLS settings")
+	}
+	if insecureClient.Transport != newRegistryHTTPClient(providerConfig, true).Transport {
+		t.Errorf("Expected the transport to be shared by clients with the same TLS settings")
+	}
+}
+
+func TestNewRegistryTransport_tls(t *testing.T) {
+	if minVersion := newRegistryTransport(&ProviderConfig{}, registryTransportKey{}).TLSClientConfig.MinVersion; minVersion != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 as minimum version by default, but got %x", minVersion)
+	}
+	providerConfig := &ProviderConfig{RegistryTLSMinVersion: tlsVersions["1.3"]}
+	if minVersion := newRegistryTransport(providerConfig, registryTransportKey{}).TLSClientConfig.MinVersion; minVersion != tls.VersionTLS13 {
+		t.Errorf("Expected the configured minimum version TLS 1.3, but got %x", minVersion)
+	}
+
+	protocol := ""
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocol = r.Proto
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	if _, err := getImageDigest(context.Background(), strings.TrimPrefix(server.URL, "https://"), "app", "latest", "", "", true, false, providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if protocol != "HTTP/2.0" {
+		t.Errorf("Expected the request to use HTTP/2, but got %s", protocol)
+	}
+}
+
+func BenchmarkGetImageDigest_transportCache(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cached=%t", cached), func(b *testing.B) {
+			server, connections := newCountingRegistryServer()
+			defer server.Close()
+			registry := strings.TrimPrefix(server.URL, "https://")
+
+			for i := 0; i < b.N; i++ {
+				providerConfig := &ProviderConfig{}
+				if cached {
+					providerConfig.RegistryTransports = newRegistryTransportCache()
+				}
+				if err := readImageDigests(registry, 50, providerConfig); err != nil {
+					b.Fatalf("Expected no error, but got %s", err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(connections))/float64(b.N), "handshakes/op")
+		})
+	}
+}
+
+func TestRegistryTransportUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := dir + "/registry.sock"
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets are not supported: %s", err)
+	}
+	var host string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	server.Listener = listener
+	server.StartTLS()
+	defer server.Close()
+
+	providerConfig := &ProviderConfig{
+		RegistryTransports:  newRegistryTransportCache(),
+		RegistryUnixSockets: map[string]string{"registry.local": socket},
+	}
+	result, err := getImageDigest(context.Background(), "registry.local:5000", "app", "latest", "", "", true, false, providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result.Digest != "sha256:foo" {
+		t.Errorf("Expected digest 'sha256:foo', but got '%s'", result.Digest)
+	}
+	if host != "registry.local:5000" {
+		t.Errorf("Expected the Host header of the registry, but got '%s'", host)
+	}
+
+	// other registries are dialed as usual
+	if _, err := getImageDigest(context.Background(), "other.invalid", "app", "latest", "", "", true, false, providerConfig); err == nil {
+		t.Errorf("Expected an error for a registry without socket")
+	}
+}
+
+func TestRegistryUnixSocket(t *testing.T) {
+	sockets := map[string]string{
+		"registry.local":       "/run/registry.sock",
+		"localhost:5000":       "/run/localhost.sock",
+		"registry-1.docker.io": "/run/hub.sock",
+	}
+	cases := []struct {
+		addr     string
+		expected string
+	}{
+		{"registry.local:443", "/run/registry.sock"},
+		{"registry.local:5000", "/run/registry.sock"},
+		{"localhost:5000", "/run/localhost.sock"},
+		{"localhost:5001", ""},
+		{"registry-1.docker.io:443", "/run/hub.sock"},
+		{"example.com:443", ""},
+	}
+	for _, c := range cases {
+		socket, ok := registryUnixSocket(sockets, c.addr)
+		if socket != c.expected || ok != (c.expected != "") {
+			t.Errorf("Expected socket '%s' for %s, but got '%s'", c.expected, c.addr, socket)
+		}
+	}
+}
+
+func TestRegistryTransportTLSOverride(t *testing.T) {
+	serverName, protocol := "", ""
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName, protocol = r.TLS.ServerName, r.Proto
+		w.Header().Set("Docker-Content-Digest", "sha256:foo")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	// the certificate of the test server is issued for example.com
+	providerConfig := &ProviderConfig{
+		RegistryRootCAs:      rootCAs,
+		RegistryTLSOverrides: map[string]registryTLSOverride{"127.0.0.1": {serverName: "example.com"}},
+	}
+	if _, err := getImageDigest(context.Background(), registry, "app", "latest", "", "", false, false, providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if serverName != "example.com" {
+		t.Errorf("Expected the configured server name to be sent as SNI, but got '%s'", serverName)
+	}
+	if protocol != "HTTP/2.0" {
+		t.Errorf("Expected the request to use HTTP/2, but got %s", protocol)
+	}
+
+	providerConfig.RegistryTLSOverrides = map[string]registryTLSOverride{registry: {serverName: "registry.invalid"}}
+	if _, err := getImageDigest(context.Background(), registry, "app", "latest", "", "", false, false, providerConfig); err == nil || !strings.Contains(err.Error(), "registry.invalid") {
+		t.Errorf("Expected the certificate to be verified against the configured server name, but got %v", err)
+	}
+
+	config := &tls.Config{ServerName: "registry.local"}
+	registryTLSOverride{renegotiation: true}.apply(config)
+	if config.Renegotiation != tls.RenegotiateOnceAsClient || config.ServerName != "registry.local" {
+		t.Errorf("Expected renegotiation to be allowed once without changing the server name, but got %+v", config)
+	}
+}
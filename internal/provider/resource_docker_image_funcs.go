@@ -9,6 +9,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/url"
 	"path/filepath"
 	"strings"
 
@@ -190,7 +191,7 @@ func pullImage(ctx context.Context, data *Data, client *client.Client, authConfi
 		}
 	} else {
 		// Try to find an auth config for the public docker hub if a registry wasn't given
-		if authConfig, ok := authConfig.Configs["https://registry-1.docker.io"]; ok {
+		if authConfig, ok := authConfig.Configs["https://"+dockerHubRegistry]; ok {
 			auth = authConfig
 		}
 	}
@@ -221,24 +222,48 @@ func pullImage(ctx context.Context, data *Data, client *client.Client, authConfi
 type internalPullImageOptions struct {
 	Repository string `qs:"fromImage"`
 	Tag        string
+	Digest     string
 
 	// Only required for Docker Engine 1.9 or 1.10 w/ Remote API < 1.21
 	// and Docker Engine < 1.9
 	// This parameter was removed in Docker Engine 1.11
 	Registry string
+
+	// Username and Password are the credentials embedded in the reference, e.g. user:pass@registry.example.com/app
+	Username string
+	Password string
 }
 
+// imageReferenceSchemes are the transport prefixes of references copied from tools like skopeo, e.g. docker://alpine.
+// They name how the image is accessed rather than the image itself.
+var imageReferenceSchemes = []string{"docker://", "oci://"}
+
 func parseImageOptions(image string) internalPullImageOptions {
 	pullOpts := internalPullImageOptions{}
 
+	for _, scheme := range imageReferenceSchemes {
+		image = strings.TrimPrefix(image, scheme)
+	}
+
+	userinfo, image := splitImageUserinfo(image)
+	if userinfo != "" {
+		pullOpts.Username, pullOpts.Password = parseImageUserinfo(userinfo)
+	}
+
+	// A digest pins the image, e.g. alpine@sha256:..., and may follow a tag
+	if digestIndex := strings.Index(image, "@"); digestIndex != -1 {
+		pullOpts.Digest = image[digestIndex+1:]
+		image = image[:digestIndex]
+	}
+
 	// Pre-fill with image by default, update later if tag found
 	pullOpts.Repository = image
 
 	firstSlash := strings.Index(image, "/")
 
-	// Detect the registry name - it should either contain port, be fully qualified or be localhost
+	// Detect the registry name - it should either contain port, be fully qualified, be localhost or a bracketed IPv6 address
 	// If the image contains more than 2 path components, or at least one and the prefix looks like a hostname
-	if strings.Count(image, "/") > 1 || firstSlash != -1 && (strings.ContainsAny(image[:firstSlash], ".:") || image[:firstSlash] == "localhost") {
+	if strings.Count(image, "/") > 1 || firstSlash != -1 && (strings.ContainsAny(image[:firstSlash], ".:") || image[:firstSlash] == "localhost" || isBracketedHost(image[:firstSlash])) {
 		// registry/repo/image
 		pullOpts.Registry = image[:firstSlash]
 	}
@@ -252,13 +277,69 @@ func parseImageOptions(image string) internalPullImageOptions {
 		pullOpts.Tag = image[prefixLength+tagIndex+1:]
 	}
 
-	if pullOpts.Tag == "" {
+	if pullOpts.Tag == "" && pullOpts.Digest == "" {
 		pullOpts.Tag = "latest"
 	}
 
 	return pullOpts
 }
 
+// splitImageUserinfo splits credentials preceding the registry host off the image, e.g. user:pass@registry.example.com/app.
+// Unlike the @ of a digest, the @ of credentials comes before the first slash.
+func splitImageUserinfo(image string) (string, string) {
+	slash := strings.Index(image, "/")
+	if slash == -1 {
+		return "", image
+	}
+	at := strings.LastIndex(image[:slash], "@")
+	if at == -1 {
+		return "", image
+	}
+	return image[:at], image[at+1:]
+}
+
+// parseImageUserinfo returns the username and password of credentials embedded in an image reference.
+// Special characters, e.g. a slash in the password, have to be percent-encoded like in URLs.
+func parseImageUserinfo(userinfo string) (string, string) {
+	username, password := userinfo, ""
+	if colon := strings.Index(userinfo, ":"); colon != -1 {
+		username, password = userinfo[:colon], userinfo[colon+1:]
+	}
+	if unescaped, err := url.PathUnescape(username); err == nil {
+		username = unescaped
+	}
+	if unescaped, err := url.PathUnescape(password); err == nil {
+		password = unescaped
+	}
+	return username, password
+}
+
+// isBracketedHost returns true for an IPv6 address in brackets, optionally followed by a port, e.g. [::1]:5000.
+// The colons of the address are part of the host and must not be mistaken for the tag separator.
+func isBracketedHost(host string) bool {
+	end := strings.Index(host, "]")
+	if !strings.HasPrefix(host, "[") || end == -1 {
+		return false
+	}
+	return end == len(host)-1 || host[end+1] == ':'
+}
+
+// reference returns the digest if the image is pinned to one, the tag otherwise
+func (o internalPullImageOptions) reference() string {
+	if o.Digest != "" {
+		return o.Digest
+	}
+	return o.Tag
+}
+
+// imageName returns the repository with the tag, or with the digest if the image is pinned to one
+func (o internalPullImageOptions) imageName() string {
+	if o.Digest != "" {
+		return o.Repository + "@" + o.Digest
+	}
+	return o.Repository + ":" + o.Tag
+}
+
 func findImage(ctx context.Context, imageName string, client *client.Client, authConfig *AuthConfigs) (*types.ImageSummary, error) {
 	if imageName == "" {
 		return nil, fmt.Errorf("empty image name is not allowed")
@@ -5,7 +5,6 @@ import (
 	"bufio"
 	"context"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -50,9 +49,10 @@ func resourceDockerRegistryImageCreate(ctx context.Context, d *schema.ResourceDa
 	if err := pushDockerRegistryImage(ctx, client, pushOpts, username, password); err != nil {
 		return diag.Errorf("Error pushing docker image: %s", err)
 	}
+	providerConfig.RegistryDigests.clear()
 
 	insecureSkipVerify := d.Get("insecure_skip_verify").(bool)
-	digest, err := getImageDigestWithFallback(pushOpts, username, password, insecureSkipVerify)
+	digest, err := getImageDigestWithFallback(ctx, pushOpts, username, password, insecureSkipVerify, providerConfig)
 	if err != nil {
 		return diag.Errorf("Unable to create image, image not found: %s", err)
 	}
@@ -68,7 +68,7 @@ func resourceDockerRegistryImageRead(ctx context.Context, d *schema.ResourceData
 	username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
 
 	insecureSkipVerify := d.Get("insecure_skip_verify").(bool)
-	digest, err := getImageDigestWithFallback(pushOpts, username, password, insecureSkipVerify)
+	digest, err := getImageDigestWithFallback(ctx, pushOpts, username, password, insecureSkipVerify, providerConfig)
 	if err != nil {
 		log.Printf("Got error getting registry image digest: %s", err)
 		d.SetId("")
@@ -87,9 +87,10 @@ func resourceDockerRegistryImageDelete(ctx context.Context, d *schema.ResourceDa
 	pushOpts := createPushImageOptions(name)
 	username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
 	digest := d.Get("sha256_digest").(string)
-	err := deleteDockerRegistryImage(pushOpts, digest, username, password, true, false)
+	providerConfig.RegistryDigests.clear()
+	err := deleteDockerRegistryImage(pushOpts, digest, username, password, true, false, providerConfig)
 	if err != nil {
-		err = deleteDockerRegistryImage(pushOpts, pushOpts.Tag, username, password, true, true)
+		err = deleteDockerRegistryImage(pushOpts, pushOpts.Tag, username, password, true, true, providerConfig)
 		if err != nil {
 			return diag.Errorf("Got error deleting registry image: %s", err)
 		}
@@ -454,20 +455,17 @@ func getDockerRegistryImageRegistryUserNameAndPassword(
 	registry := pushOpts.NormalizedRegistry
 	username := ""
 	password := ""
-	if authConfig, ok := providerConfig.AuthConfigs.Configs[registry]; ok {
+	if authConfig, ok := providerConfig.AuthConfigs.lookup(registry); ok {
 		username = authConfig.Username
 		password = authConfig.Password
 	}
 	return username, password
 }
 
-func deleteDockerRegistryImage(pushOpts internalPushImageOptions, sha256Digest, username, password string, insecureSkipVerify, fallback bool) error {
-	client := http.DefaultClient
+func deleteDockerRegistryImage(pushOpts internalPushImageOptions, sha256Digest, username, password string, insecureSkipVerify, fallback bool, providerConfig *ProviderConfig) error {
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
 
-	// DevSkim: ignore DS440000
-	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipVerify}}
-
-	req, err := http.NewRequest("DELETE", pushOpts.NormalizedRegistry+"/v2/"+pushOpts.Repository+"/manifests/"+sha256Digest, nil)
+	req, err := http.NewRequest("DELETE", pushOpts.NormalizedRegistry+providerConfig.RegistryAPIPathPrefix+"/v2/"+pushOpts.Repository+"/manifests/"+sha256Digest, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting registry image: %s", err)
 	}
@@ -500,7 +498,10 @@ func deleteDockerRegistryImage(pushOpts internalPushImageOptions, sha256Digest,
 	// Either OAuth is required or the basic auth creds were invalid
 	case http.StatusUnauthorized:
 		if strings.HasPrefix(resp.Header.Get("www-authenticate"), "Bearer") {
-			auth := parseAuthHeader(resp.Header.Get("www-authenticate"))
+			auth, err := parseAuthHeader(resp.Header.Get("www-authenticate"))
+			if err != nil {
+				return fmt.Errorf("Error parsing the authentication challenge of the registry: %s", err)
+			}
 			params := url.Values{}
 			params.Set("service", auth["service"])
 			params.Set("scope", auth["scope"])
@@ -522,9 +523,9 @@ func deleteDockerRegistryImage(pushOpts internalPushImageOptions, sha256Digest,
 				return fmt.Errorf("Got bad response from registry: " + tokenResponse.Status)
 			}
 
-			body, err := ioutil.ReadAll(tokenResponse.Body)
+			body, err := readRegistryResponseBody(tokenResponse, providerConfig)
 			if err != nil {
-				return fmt.Errorf("Error reading response body: %s", err)
+				return err
 			}
 
 			token := &TokenResponse{}
@@ -555,21 +556,21 @@ func deleteDockerRegistryImage(pushOpts internalPushImageOptions, sha256Digest,
 	}
 }
 
-func getImageDigestWithFallback(opts internalPushImageOptions, username, password string, insecureSkipVerify bool) (string, error) {
-	digest, err := getImageDigest(opts.Registry, opts.Repository, opts.Tag, username, password, insecureSkipVerify, false)
+func getImageDigestWithFallback(ctx context.Context, opts internalPushImageOptions, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) (string, error) {
+	result, err := getImageDigest(ctx, opts.Registry, opts.Repository, opts.Tag, username, password, insecureSkipVerify, false, providerConfig)
+	if shouldFallbackToSchema1(err) {
+		result, err = getImageDigest(ctx, opts.Registry, opts.Repository, opts.Tag, username, password, insecureSkipVerify, true, providerConfig)
+	}
 	if err != nil {
-		digest, err = getImageDigest(opts.Registry, opts.Repository, opts.Tag, username, password, insecureSkipVerify, true)
-		if err != nil {
-			return "", fmt.Errorf("unable to get digest: %s", err)
-		}
+		return "", fmt.Errorf("unable to get digest: %s", err)
 	}
-	return digest, nil
+	return result.Digest, nil
 }
 
 func createPushImageOptions(image string) internalPushImageOptions {
 	pullOpts := parseImageOptions(image)
 	if pullOpts.Registry == "" {
-		pullOpts.Registry = "registry-1.docker.io"
+		pullOpts.Registry = dockerHubRegistry
 	} else {
 		pullOpts.Repository = strings.Replace(pullOpts.Repository, pullOpts.Registry+"/", "", 1)
 	}
@@ -224,7 +224,7 @@ func testDockerRegistryImageNotInRegistry(pushOpts internalPushImageOptions) res
 	return func(s *terraform.State) error {
 		providerConfig := testAccProvider.Meta().(*ProviderConfig)
 		username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
-		digest, _ := getImageDigestWithFallback(pushOpts, username, password, true)
+		digest, _ := getImageDigestWithFallback(context.Background(), pushOpts, username, password, true, &ProviderConfig{})
 		if digest != "" {
 			return fmt.Errorf("image found")
 		}
@@ -234,12 +234,12 @@ func testDockerRegistryImageNotInRegistry(pushOpts internalPushImageOptions) res
 
 func testDockerRegistryImageInRegistry(username, password string, pushOpts internalPushImageOptions, cleanup bool) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		digest, err := getImageDigestWithFallback(pushOpts, username, password, true)
+		digest, err := getImageDigestWithFallback(context.Background(), pushOpts, username, password, true, &ProviderConfig{})
 		if err != nil || len(digest) < 1 {
 			return fmt.Errorf("image '%s' with credentials('%s' - '%s') not found: %w", pushOpts.Name, username, password, err)
 		}
 		if cleanup {
-			err := deleteDockerRegistryImage(pushOpts, digest, username, password, true, false)
+			err := deleteDockerRegistryImage(pushOpts, digest, username, password, true, false, &ProviderConfig{})
 			if err != nil {
 				return fmt.Errorf("Unable to remove test image '%s': %w", pushOpts.Name, err)
 			}
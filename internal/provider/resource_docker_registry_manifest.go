@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceDockerRegistryManifest() *schema.Resource {
+	return &schema.Resource{
+		Description: "Manages an image manifest in a Docker Registry, which is deleted from the registry on destroy. The image itself has to be pushed by other means, e.g. by a `docker_registry_image` resource or a CI pipeline.",
+
+		CreateContext: resourceDockerRegistryManifestCreate,
+		ReadContext:   resourceDockerRegistryManifestRead,
+		UpdateContext: resourceDockerRegistryManifestUpdate,
+		DeleteContext: resourceDockerRegistryManifestDelete,
+		CustomizeDiff: resourceDockerRegistryManifestCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "The name of the Docker image, including any tags or a digest. e.g. `registry.example.com/app:1.0`",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"sha256_digest": {
+				Type:        schema.TypeString,
+				Description: "The content digest of the manifest the name resolved to on creation. The manifest is deleted by this digest, as most registries do not support deleting tags. A tag moved to another manifest is planned as a replacement.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceDockerRegistryManifestCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	digest, err := resolveRegistryManifestDigest(ctx, d, meta.(*ProviderConfig))
+	if err != nil {
+		return diag.Errorf("Got error when attempting to fetch the manifest of %s from registry: %s", redactImageRef(d.Get("name").(string)), err)
+	}
+
+	d.SetId(digest)
+	d.Set("sha256_digest", digest)
+	return nil
+}
+
+func resourceDockerRegistryManifestRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// the manifest created is looked up by its digest, the tag is only resolved again when planning
+	_, err := getRegistryManifestDigest(ctx, d.Get("name").(string), d.Id(), d.Get("insecure_skip_verify").(bool), meta.(*ProviderConfig))
+	if isManifestNotFound(err) {
+		log.Printf("[WARN] Manifest %s of %s not found in the registry, removing it from the state", d.Id(), redactImageRef(d.Get("name").(string)))
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("Got error when attempting to fetch the manifest %s of %s from registry: %s", d.Id(), redactImageRef(d.Get("name").(string)), err)
+	}
+
+	d.Set("sha256_digest", d.Id())
+	return nil
+}
+
+func resourceDockerRegistryManifestUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceDockerRegistryManifestRead(ctx, d, meta)
+}
+
+func resourceDockerRegistryManifestDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	pullOpts := normalizeImageRef(d.Get("name").(string), providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+
+	username, password, err := getImageRefCredentials(ctx, pullOpts, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	providerConfig.RegistryDigests.clear()
+	digest := d.Id()
+	err = deleteRegistryManifest(ctx, pullOpts.Registry, pullOpts.Repository, digest, username, password, d.Get("insecure_skip_verify").(bool), providerConfig)
+	var responseErr *registryResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.StatusCode {
+		case http.StatusNotFound:
+			return nil
+		case http.StatusMethodNotAllowed:
+			return diag.Diagnostics{{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("The registry does not allow deleting the manifest %s of %s", digest, redactImageRef(d.Get("name").(string))),
+				Detail:   "Deletes are disabled in the registry configuration, the manifest was only removed from the state.",
+			}}
+		}
+	}
+	if err != nil {
+		return diag.Errorf("Got error when attempting to delete the manifest %s of %s from registry: %s", digest, redactImageRef(d.Get("name").(string)), err)
+	}
+
+	return nil
+}
+
+// resourceDockerRegistryManifestCustomizeDiff plans the replacement of the manifest if the tag was moved to another
+// manifest, the refresh keeps the digest of the manifest created
+func resourceDockerRegistryManifestCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || d.HasChange("name") {
+		return nil
+	}
+
+	current, err := getRegistryManifestDigest(ctx, d.Get("name").(string), "", d.Get("insecure_skip_verify").(bool), meta.(*ProviderConfig))
+	if err != nil {
+		// a tag which cannot be resolved leaves the manifest created as it is
+		log.Printf("[WARN] Unable to resolve %s in the registry: %s", redactImageRef(d.Get("name").(string)), err)
+		return nil
+	}
+	if current == d.Id() {
+		return nil
+	}
+
+	if err := d.SetNew("sha256_digest", current); err != nil {
+		return err
+	}
+	return d.ForceNew("sha256_digest")
+}
+
+// resolveRegistryManifestDigest returns the digest the name of the resource currently refers to
+func resolveRegistryManifestDigest(ctx context.Context, d *schema.ResourceData, providerConfig *ProviderConfig) (string, error) {
+	return getRegistryManifestDigest(ctx, d.Get("name").(string), "", d.Get("insecure_skip_verify").(bool), providerConfig)
+}
+
+// getRegistryManifestDigest returns the digest of the manifest reference refers to in the repository of name. An
+// empty reference stands for the tag or digest of name.
+func getRegistryManifestDigest(ctx context.Context, name, reference string, insecureSkipVerify bool, providerConfig *ProviderConfig) (string, error) {
+	pullOpts := normalizeImageRef(name, providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+	if reference == "" {
+		reference = pullOpts.reference()
+	}
+
+	username, password, err := getImageRefCredentials(ctx, pullOpts, providerConfig)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := getImageDigest(ctx, pullOpts.Registry, pullOpts.Repository, reference, username, password, insecureSkipVerify, false, providerConfig)
+	if shouldFallbackToSchema1(err) {
+		result, err = getImageDigest(ctx, pullOpts.Registry, pullOpts.Repository, reference, username, password, insecureSkipVerify, true, providerConfig)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return result.Digest, nil
+}
+
+// deleteRegistryManifest deletes the manifest by its digest, registries following the distribution spec reject deleting by tag
+func deleteRegistryManifest(ctx context.Context, registry, image, digest, username, password string, insecureSkipVerify bool, providerConfig *ProviderConfig) error {
+	release, err := providerConfig.RegistryRequests.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	client := newRegistryHTTPClient(providerConfig, insecureSkipVerify)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", registryURL(registry, providerConfig)+"/v2/"+image+"/manifests/"+digest, nil)
+	if err != nil {
+		return fmt.Errorf("Error creating registry request: %s", err)
+	}
+
+	resp, err := doRegistryRequest(client, req, registry, username, password, providerConfig)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceDockerRegistryManifest(t *testing.T) {
+	digest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	moved := "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	manifests := map[string]string{"1.0": digest, digest: digest, moved: moved}
+	deleteStatus := http.StatusAccepted
+	var deletedPath string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			manifestDigest, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/app/manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.Write([]byte(`{}`))
+		case "DELETE":
+			deletedPath = r.URL.Path
+			w.WriteHeader(deleteStatus)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}, RegistryTokens: newRegistryTokenCache()}
+
+	raw := map[string]interface{}{
+		"name":                 registry + "/app:1.0",
+		"insecure_skip_verify": true,
+	}
+	d := schema.TestResourceDataRaw(t, resourceDockerRegistryManifest().Schema, raw)
+	if diags := resourceDockerRegistryManifestCreate(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Id() != digest || d.Get("sha256_digest").(string) != digest {
+		t.Errorf("Expected the digest %s, but got %s", digest, d.Get("sha256_digest").(string))
+	}
+
+	if instanceDiff, err := resourceDockerRegistryManifest().Diff(context.Background(), d.State(), terraform.NewResourceConfigRaw(raw), providerConfig); err != nil || !instanceDiff.Empty() {
+		t.Fatalf("Expected no changes while the tag points at the manifest created, but got %v and %v", instanceDiff, err)
+	}
+
+	// the tag is moved, the refresh keeps the manifest created and the plan replaces it
+	manifests["1.0"] = moved
+	if diags := resourceDockerRegistryManifestRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Id() != digest || d.Get("sha256_digest").(string) != digest {
+		t.Errorf("Expected the refresh to keep the digest %s, but got %s", digest, d.Get("sha256_digest").(string))
+	}
+	instanceDiff, err := resourceDockerRegistryManifest().Diff(context.Background(), d.State(), terraform.NewResourceConfigRaw(raw), providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if instanceDiff == nil || instanceDiff.Attributes["sha256_digest"] == nil || !instanceDiff.Attributes["sha256_digest"].RequiresNew {
+		t.Fatalf("Expected the moved tag to be planned as replacement, but got %v", instanceDiff)
+	}
+
+	if diags := resourceDockerRegistryManifestDelete(context.Background(), d, providerConfig); len(diags) != 0 {
+		t.Fatalf("Expected no diagnostics, but got %v", diags)
+	}
+	if deletedPath != "/v2/app/manifests/"+digest {
+		t.Errorf("Expected the manifest created to be deleted by digest, but got %s", deletedPath)
+	}
+
+	deleteStatus = http.StatusMethodNotAllowed
+	diags := resourceDockerRegistryManifestDelete(context.Background(), d, providerConfig)
+	if len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Errorf("Expected a warning if deletes are disabled, but got %v", diags)
+	}
+
+	delete(manifests, digest)
+	if diags := resourceDockerRegistryManifestRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("Expected a missing manifest to be removed from the state")
+	}
+}
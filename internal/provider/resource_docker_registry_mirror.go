@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceDockerRegistryMirror() *schema.Resource {
+	return &schema.Resource{
+		Description: "Copies an image from a source registry to a destination registry, e.g. a backup registry for disaster recovery, without a Docker daemon. Manifest lists are copied with the images of all platforms. Blobs the destination has already are skipped, and within the same registry they are mounted instead of being copied. The image is copied again if the destination no longer matches the source, e.g. after the source tag was moved. The transfer of blobs is not limited by the `timeout` of the provider but by the `create` timeout of the resource. Schema 1 manifests cannot be copied.",
+
+		CreateContext: resourceDockerRegistryMirrorCreate,
+		ReadContext:   resourceDockerRegistryMirrorRead,
+		UpdateContext: resourceDockerRegistryMirrorUpdate,
+		DeleteContext: resourceDockerRegistryMirrorDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"source": {
+				Type:        schema.TypeString,
+				Description: "The name of the image to copy, including any tags or a digest. e.g. `alpine:3.16` or `registry.example.com/app@sha256:...`",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"destination": {
+				Type:        schema.TypeString,
+				Description: "The name the image is stored under in the destination registry, including a tag. e.g. `backup.example.com/alpine:3.16`",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of both registries is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"delete_on_destroy": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the manifest is deleted from the destination registry on destroy. Blobs are left to the garbage collection of the registry. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"sha256_digest": {
+				Type:        schema.TypeString,
+				Description: "The content digest of the copied manifest, which is the same in both registries.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceDockerRegistryMirrorCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	src, dst, srcReference, dstReference, err := registryMirrorEndpoints(ctx, d, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	client := newRegistryHTTPClient(providerConfig, d.Get("insecure_skip_verify").(bool))
+	digest, err := copyRegistryManifest(ctx, client, src, dst, srcReference, dstReference, providerConfig)
+	if err != nil {
+		return diag.Errorf("Got error when attempting to copy %s to %s: %s", redactImageRef(d.Get("source").(string)), redactImageRef(d.Get("destination").(string)), err)
+	}
+	providerConfig.RegistryDigests.clear()
+
+	d.SetId(digest)
+	d.Set("sha256_digest", digest)
+	return nil
+}
+
+func resourceDockerRegistryMirrorRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	providerConfig := meta.(*ProviderConfig)
+	src, dst, srcReference, dstReference, err := registryMirrorEndpoints(ctx, d, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	insecureSkipVerify := d.Get("insecure_skip_verify").(bool)
+	dstResult, err := getImageDigest(ctx, dst.Registry, dst.Repository, dstReference, dst.Username, dst.Password, insecureSkipVerify, false, providerConfig)
+	if isManifestNotFound(err) {
+		log.Printf("[WARN] Image %s not found in the destination registry, removing it from the state", redactImageRef(d.Get("destination").(string)))
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("Got error when attempting to fetch the digest of %s from registry: %s", redactImageRef(d.Get("destination").(string)), err)
+	}
+
+	// the destination is meant to outlive the source, e.g. during an outage of the source registry
+	var diags diag.Diagnostics
+	srcResult, err := getImageDigest(ctx, src.Registry, src.Repository, srcReference, src.Username, src.Password, insecureSkipVerify, false, providerConfig)
+	switch {
+	case err != nil:
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Unable to compare %s with its source", redactImageRef(d.Get("destination").(string))),
+			Detail:   fmt.Sprintf("The digest of the source %s could not be read, only the existence of the destination was checked: %s", redactImageRef(d.Get("source").(string)), err),
+		})
+	case srcResult.Digest != dstResult.Digest:
+		log.Printf("[WARN] Image %s differs from its source %s, removing it from the state to copy it again", redactImageRef(d.Get("destination").(string)), redactImageRef(d.Get("source").(string)))
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("sha256_digest", dstResult.Digest)
+	return diags
+}
+
+func resourceDockerRegistryMirrorUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceDockerRegistryMirrorRead(ctx, d, meta)
+}
+
+func resourceDockerRegistryMirrorDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if !d.Get("delete_on_destroy").(bool) {
+		return nil
+	}
+
+	providerConfig := meta.(*ProviderConfig)
+	_, dst, _, _, err := registryMirrorEndpoints(ctx, d, providerConfig)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	providerConfig.RegistryDigests.clear()
+	digest := d.Get("sha256_digest").(string)
+	err = deleteRegistryManifest(ctx, dst.Registry, dst.Repository, digest, dst.Username, dst.Password, d.Get("insecure_skip_verify").(bool), providerConfig)
+	var responseErr *registryResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.StatusCode {
+		case http.StatusNotFound:
+			return nil
+		case http.StatusMethodNotAllowed:
+			return diag.Diagnostics{{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("The registry does not allow deleting the manifest %s of %s", digest, redactImageRef(d.Get("destination").(string))),
+				Detail:   "Deletes are disabled in the registry configuration, the manifest was only removed from the state.",
+			}}
+		}
+	}
+	if err != nil {
+		return diag.Errorf("Got error when attempting to delete the manifest %s of %s from registry: %s", digest, redactImageRef(d.Get("destination").(string)), err)
+	}
+
+	return nil
+}
+
+// registryMirrorEndpoints returns the source and destination of the resource with their credentials, along with the
+// reference of the source and the one the image is stored under in the destination
+func registryMirrorEndpoints(ctx context.Context, d *schema.ResourceData, providerConfig *ProviderConfig) (registryCopyEndpoint, registryCopyEndpoint, string, string, error) {
+	var endpoints [2]registryCopyEndpoint
+	var references [2]string
+	for i, attribute := range []string{"source", "destination"} {
+		pullOpts := normalizeImageRef(d.Get(attribute).(string), providerConfig.DefaultRegistry, providerConfig.HubRegistry)
+		username, password, err := getImageRefCredentials(ctx, pullOpts, providerConfig)
+		if err != nil {
+			return registryCopyEndpoint{}, registryCopyEndpoint{}, "", "", err
+		}
+		endpoints[i] = registryCopyEndpoint{
+			Registry:   pullOpts.Registry,
+			Repository: pullOpts.Repository,
+			Username:   username,
+			Password:   password,
+		}
+		references[i] = pullOpts.reference()
+	}
+	return endpoints[0], endpoints[1], references[0], references[1], nil
+}
@@ -0,0 +1,300 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// fakeRegistry stores manifests and blobs in memory and accepts uploads like a registry following the distribution spec
+type fakeRegistry struct {
+	mu        sync.Mutex
+	manifests map[string][]byte
+	types     map[string]string
+	blobs     map[string][]byte
+	mounts    int
+	uploads   int
+	// token requires requests to authenticate with a bearer token if set
+	token string
+	// blobDelay delays the download of blobs, e.g. to simulate large layers
+	blobDelay time.Duration
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{manifests: map[string][]byte{}, types: map[string]string{}, blobs: map[string][]byte{}}
+}
+
+func (f *fakeRegistry) digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// putManifest stores the manifest under repository and reference, and under its digest
+func (f *fakeRegistry) putManifest(repository, reference, mediaType string, content []byte) string {
+	digest := f.digest(content)
+	for _, ref := range []string{reference, digest} {
+		f.manifests[repository+":"+ref] = content
+		f.types[repository+":"+ref] = mediaType
+	}
+	return digest
+}
+
+func (f *fakeRegistry) putBlob(repository string, content []byte) string {
+	digest := f.digest(content)
+	f.blobs[repository+"@"+digest] = content
+	return digest
+}
+
+func (f *fakeRegistry) serve(server *httptest.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if f.token != "" {
+			if r.URL.Path == "/token" {
+				fmt.Fprintf(w, `{"token":"%s"}`, f.token)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer "+f.token {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:backup:pull,push"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		if r.Method == "GET" && strings.Contains(path, "/blobs/") {
+			time.Sleep(f.blobDelay)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch {
+		case strings.Contains(path, "/manifests/"):
+			parts := strings.SplitN(path, "/manifests/", 2)
+			key := parts[0] + ":" + parts[1]
+			if r.Method == "PUT" {
+				body, _ := ioutil.ReadAll(r.Body)
+				for _, descriptor := range manifestBlobs(body) {
+					if _, ok := f.blobs[parts[0]+"@"+descriptor]; !ok {
+						if _, ok := f.manifests[parts[0]+":"+descriptor]; !ok {
+							w.WriteHeader(http.StatusBadRequest)
+							fmt.Fprintf(w, `{"errors":[{"code":"MANIFEST_BLOB_UNKNOWN","message":"%s"}]}`, descriptor)
+							return
+						}
+					}
+				}
+				w.Header().Set("Docker-Content-Digest", f.putManifest(parts[0], parts[1], r.Header.Get("Content-Type"), body))
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			content, ok := f.manifests[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`)
+				return
+			}
+			w.Header().Set("Content-Type", f.types[key])
+			w.Header().Set("Docker-Content-Digest", f.digest(content))
+			w.Write(content)
+		case strings.HasSuffix(path, "/blobs/uploads/"):
+			repository := strings.TrimSuffix(path, "/blobs/uploads/")
+			if mount, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from"); mount != "" {
+				if content, ok := f.blobs[from+"@"+mount]; ok {
+					f.blobs[repository+"@"+mount] = content
+					f.mounts++
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+			}
+			w.Header().Set("Location", "/upload/"+repository+"?session=1")
+			w.WriteHeader(http.StatusAccepted)
+		case strings.HasPrefix(r.URL.Path, "/upload/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			digest := r.URL.Query().Get("digest")
+			if f.digest(body) != digest {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"errors":[{"code":"DIGEST_INVALID"}]}`)
+				return
+			}
+			f.blobs[strings.TrimPrefix(r.URL.Path, "/upload/")+"@"+digest] = body
+			f.uploads++
+			w.WriteHeader(http.StatusCreated)
+		case strings.Contains(path, "/blobs/"):
+			parts := strings.SplitN(path, "/blobs/", 2)
+			content, ok := f.blobs[parts[0]+"@"+parts[1]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// manifestBlobs returns the digests a manifest references
+func manifestBlobs(body []byte) []string {
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil
+	}
+	digests := []string{}
+	for _, descriptor := range append(append([]registryDescriptor{manifest.Config}, manifest.Layers...), manifest.Manifests...) {
+		if descriptor.Digest != "" {
+			digests = append(digests, descriptor.Digest)
+		}
+	}
+	return digests
+}
+
+func startFakeRegistry(f *fakeRegistry) (*httptest.Server, string) {
+	var server *httptest.Server
+	server = httptest.NewUnstartedServer(nil)
+	server.Config.Handler = f.serve(server)
+	server.StartTLS()
+	return server, strings.TrimPrefix(server.URL, "https://")
+}
+
+// addFakeImage stores a multi-platform image with a config and a layer per platform under repository:tag
+func addFakeImage(f *fakeRegistry, repository, tag string) string {
+	manifests := []string{}
+	for _, platform := range []string{"amd64", "arm64"} {
+		config := f.putBlob(repository, []byte(`{"architecture":"`+platform+`"}`))
+		layer := f.putBlob(repository, []byte("layer of "+platform))
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":%d},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"%s","size":%d}]}`,
+			config, len(`{"architecture":"`+platform+`"}`), layer, len("layer of "+platform))
+		digest := f.putManifest(repository, "", "application/vnd.oci.image.manifest.v1+json", []byte(manifest))
+		manifests = append(manifests, fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":%d,"platform":{"os":"linux","architecture":"%s"}}`, digest, len(manifest), platform))
+	}
+	index := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` + strings.Join(manifests, ",") + `]}`
+	return f.putManifest(repository, tag, "application/vnd.oci.image.index.v1+json", []byte(index))
+}
+
+func TestResourceDockerRegistryMirror(t *testing.T) {
+	source := newFakeRegistry()
+	digest := addFakeImage(source, "app", "1.0")
+	sourceServer, sourceRegistry := startFakeRegistry(source)
+	defer sourceServer.Close()
+
+	destination := newFakeRegistry()
+	destination.token = "push"
+	destinationServer, destinationRegistry := startFakeRegistry(destination)
+	defer destinationServer.Close()
+
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}, RegistryTokens: newRegistryTokenCache()}
+	d := schema.TestResourceDataRaw(t, resourceDockerRegistryMirror().Schema, map[string]interface{}{
+		"source":               sourceRegistry + "/app:1.0",
+		"destination":          destinationRegistry + "/backup:1.0",
+		"insecure_skip_verify": true,
+		"delete_on_destroy":    true,
+	})
+	if diags := resourceDockerRegistryMirrorCreate(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Id() != digest || d.Get("sha256_digest").(string) != digest {
+		t.Errorf("Expected the digest %s, but got %s", digest, d.Get("sha256_digest").(string))
+	}
+	if _, ok := destination.manifests["backup:1.0"]; !ok {
+		t.Errorf("Expected the manifest list to be stored under the tag of the destination")
+	}
+	// two configs and two layers
+	if destination.uploads != 4 {
+		t.Errorf("Expected 4 blobs to be uploaded, but got %d", destination.uploads)
+	}
+
+	if diags := resourceDockerRegistryMirrorRead(context.Background(), d, providerConfig); diags.HasError() || d.Id() == "" {
+		t.Fatalf("Expected the mirror to match its source, but got %v", diags)
+	}
+
+	// the source tag was moved
+	source.putManifest("app", "1.0", "application/vnd.oci.image.index.v1+json", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`))
+	if diags := resourceDockerRegistryMirrorRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Id() != "" {
+		t.Errorf("Expected the mirror to be removed from the state after the source changed")
+	}
+
+	d.SetId(digest)
+	if diags := resourceDockerRegistryMirrorDelete(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+}
+
+func TestCopyRegistryManifest_mount(t *testing.T) {
+	registry := newFakeRegistry()
+	addFakeImage(registry, "app", "1.0")
+	// the destination has one of the blobs already
+	registry.blobs["backup@"+registry.digest([]byte("layer of amd64"))] = []byte("layer of amd64")
+	server, host := startFakeRegistry(registry)
+	defer server.Close()
+
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}}
+	client := newRegistryHTTPClient(providerConfig, true)
+	src := registryCopyEndpoint{Registry: host, Repository: "app"}
+	dst := registryCopyEndpoint{Registry: host, Repository: "backup"}
+	if _, err := copyRegistryManifest(context.Background(), client, src, dst, "1.0", "1.0", providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if registry.mounts != 3 || registry.uploads != 0 {
+		t.Errorf("Expected the 3 missing blobs to be mounted, but got %d mounts and %d uploads", registry.mounts, registry.uploads)
+	}
+}
+
+func TestCopyRegistryManifest_slowBlob(t *testing.T) {
+	source := newFakeRegistry()
+	addFakeImage(source, "app", "1.0")
+	source.blobDelay = 200 * time.Millisecond
+	sourceServer, sourceRegistry := startFakeRegistry(source)
+	defer sourceServer.Close()
+
+	destination := newFakeRegistry()
+	destinationServer, destinationRegistry := startFakeRegistry(destination)
+	defer destinationServer.Close()
+
+	// the timeout of single requests does not apply to the transfer of blobs
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}, RegistryTimeout: 100 * time.Millisecond}
+	client := newRegistryHTTPClient(providerConfig, true)
+	src := registryCopyEndpoint{Registry: sourceRegistry, Repository: "app"}
+	dst := registryCopyEndpoint{Registry: destinationRegistry, Repository: "backup"}
+	if _, err := copyRegistryManifest(context.Background(), client, src, dst, "1.0", "1.0", providerConfig); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if destination.uploads != 4 {
+		t.Errorf("Expected 4 blobs to be uploaded, but got %d", destination.uploads)
+	}
+
+	// the context still limits the transfer
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := copyRegistryManifest(ctx, client, src, registryCopyEndpoint{Registry: destinationRegistry, Repository: "other"}, "1.0", "1.0", providerConfig); err == nil {
+		t.Errorf("Expected the copy to be cancelled by the context")
+	}
+}
+
+func TestCopyRegistryManifest_schema1(t *testing.T) {
+	registry := newFakeRegistry()
+	registry.putManifest("app", "1.0", "application/vnd.docker.distribution.manifest.v1+prettyjws", []byte(`{"schemaVersion":1,"name":"app","tag":"1.0","fsLayers":[]}`))
+	server, host := startFakeRegistry(registry)
+	defer server.Close()
+
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}}
+	client := newRegistryHTTPClient(providerConfig, true)
+	src := registryCopyEndpoint{Registry: host, Repository: "app"}
+	dst := registryCopyEndpoint{Registry: host, Repository: "backup"}
+	_, err := copyRegistryManifest(context.Background(), client, src, dst, "1.0", "1.0", providerConfig)
+	if err == nil || !strings.Contains(err.Error(), "schema 1") {
+		t.Fatalf("Expected schema 1 manifests to be rejected, but got %v", err)
+	}
+	if _, ok := registry.manifests["backup:1.0"]; ok {
+		t.Errorf("Expected the manifest not to be copied")
+	}
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceDockerRegistryPin() *schema.Resource {
+	return &schema.Resource{
+		Description: "Pins a tag in a Docker Registry to a digest. The tag is resolved on every refresh, a tag moved to another image shows up as a change of `current_digest` in the plan, and the apply fails until the tag points at the pinned digest again or `digest` is updated to accept the new image. Nothing is changed in the registry.",
+
+		CreateContext: resourceDockerRegistryPinCreate,
+		ReadContext:   resourceDockerRegistryPinRead,
+		UpdateContext: resourceDockerRegistryPinUpdate,
+		DeleteContext: resourceDockerRegistryPinDelete,
+		CustomizeDiff: resourceDockerRegistryPinCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "The name of the Docker image including the tag to pin, e.g. `registry.example.com/app:1.0`",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"digest": {
+				Type:             schema.TypeString,
+				Description:      "The digest the tag has to point at. If not set, the digest the tag points at on creation is pinned.",
+				Optional:         true,
+				Computed:         true,
+				ValidateDiagFunc: validateStringMatchesPattern(`^[a-z0-9]+:[a-f0-9]+$`),
+			},
+
+			"insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Description: "If `true`, the verification of TLS certificates of the server/registry is disabled. Defaults to `false`",
+				Optional:    true,
+				Default:     false,
+			},
+
+			"current_digest": {
+				Type:        schema.TypeString,
+				Description: "The digest the tag currently points at, as resolved on the last refresh.",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceDockerRegistryPinCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	current, err := resolveRegistryManifestDigest(ctx, d, meta.(*ProviderConfig))
+	if err != nil {
+		return diag.Errorf("Got error when attempting to fetch the manifest of %s from registry: %s", redactImageRef(d.Get("name").(string)), err)
+	}
+
+	digest := d.Get("digest").(string)
+	if digest == "" {
+		digest = current
+	}
+	if current != digest {
+		return diag.Errorf("The tag %s points at %s instead of the pinned digest %s", redactImageRef(d.Get("name").(string)), current, digest)
+	}
+
+	d.SetId(redactImageRef(d.Get("name").(string)) + "@" + digest)
+	d.Set("digest", digest)
+	d.Set("current_digest", current)
+	return nil
+}
+
+func resourceDockerRegistryPinRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	current, err := resolveRegistryManifestDigest(ctx, d, meta.(*ProviderConfig))
+	if isManifestNotFound(err) {
+		log.Printf("[WARN] Tag %s not found in the registry, removing the pin from the state", redactImageRef(d.Get("name").(string)))
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("Got error when attempting to fetch the manifest of %s from registry: %s", redactImageRef(d.Get("name").(string)), err)
+	}
+
+	d.Set("current_digest", current)
+	return nil
+}
+
+func resourceDockerRegistryPinUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	current, err := resolveRegistryManifestDigest(ctx, d, meta.(*ProviderConfig))
+	if err != nil {
+		return diag.Errorf("Got error when attempting to fetch the manifest of %s from registry: %s", redactImageRef(d.Get("name").(string)), err)
+	}
+
+	digest := d.Get("digest").(string)
+	if current != digest {
+		return diag.Errorf("The tag %s points at %s instead of the pinned digest %s. Set digest to %s to accept the new image.", redactImageRef(d.Get("name").(string)), current, digest, current)
+	}
+
+	d.SetId(redactImageRef(d.Get("name").(string)) + "@" + digest)
+	d.Set("current_digest", current)
+	return nil
+}
+
+func resourceDockerRegistryPinDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+// resourceDockerRegistryPinCustomizeDiff plans the drift of the tag as an update of current_digest back to the
+// pinned digest, which makes a moved tag visible in the plan
+func resourceDockerRegistryPinCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.NewValueKnown("digest") {
+		return nil
+	}
+
+	digest := d.Get("digest").(string)
+	if current := d.Get("current_digest").(string); current != "" && current != digest {
+		return d.SetNew("current_digest", digest)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceDockerRegistryPin(t *testing.T) {
+	pinned := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	moved := "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	digest := pinned
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}}
+
+	raw := map[string]interface{}{
+		"name":                 registry + "/app:1.0",
+		"insecure_skip_verify": true,
+	}
+	d := schema.TestResourceDataRaw(t, resourceDockerRegistryPin().Schema, raw)
+	if diags := resourceDockerRegistryPinCreate(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Get("digest").(string) != pinned {
+		t.Errorf("Expected the digest on creation to be pinned, but got %s", d.Get("digest").(string))
+	}
+
+	// the tag is moved, the refresh records the new digest and the plan moves it back to the pinned one
+	digest = moved
+	if diags := resourceDockerRegistryPinRead(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if d.Get("current_digest").(string) != moved {
+		t.Errorf("Expected the current digest %s, but got %s", moved, d.Get("current_digest").(string))
+	}
+	state := d.State()
+	instanceDiff, err := resourceDockerRegistryPin().Diff(context.Background(), state, terraform.NewResourceConfigRaw(raw), providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if instanceDiff == nil || instanceDiff.Attributes["current_digest"] == nil || instanceDiff.Attributes["current_digest"].New != pinned {
+		t.Fatalf("Expected the drift to be planned as change of current_digest, but got %v", instanceDiff)
+	}
+	if diags := resourceDockerRegistryPinUpdate(context.Background(), d, providerConfig); !diags.HasError() {
+		t.Errorf("Expected the apply to fail while the tag does not point at the pinned digest")
+	}
+
+	// accepting the new image
+	raw["digest"] = moved
+	instanceDiff, err = resourceDockerRegistryPin().Diff(context.Background(), state, terraform.NewResourceConfigRaw(raw), providerConfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if instanceDiff.Attributes["current_digest"] != nil {
+		t.Errorf("Expected no change of current_digest after accepting the new image, but got %v", instanceDiff.Attributes["current_digest"])
+	}
+	d = schema.TestResourceDataRaw(t, resourceDockerRegistryPin().Schema, raw)
+	if diags := resourceDockerRegistryPinUpdate(context.Background(), d, providerConfig); diags.HasError() {
+		t.Errorf("Expected no error after accepting the new image, but got %v", diags)
+	}
+}
+
+func TestResourceDockerRegistryPin_embeddedCredentials(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+	providerConfig := &ProviderConfig{AuthConfigs: &AuthConfigs{}}
+
+	d := schema.TestResourceDataRaw(t, resourceDockerRegistryPin().Schema, map[string]interface{}{
+		"name":                 "user:secret@" + registry + "/app:1.0",
+		"digest":               "sha256:2222222222222222222222222222222222222222222222222222222222222222",
+		"insecure_skip_verify": true,
+	})
+	diags := resourceDockerRegistryPinCreate(context.Background(), d, providerConfig)
+	if !diags.HasError() || strings.Contains(diags[0].Summary, "secret") {
+		t.Errorf("Expected an error without the password, but got %v", diags)
+	}
+
+	d.Set("digest", "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	if diags := resourceDockerRegistryPinCreate(context.Background(), d, providerConfig); diags.HasError() {
+		t.Fatalf("Expected no error, but got %v", diags)
+	}
+	if strings.Contains(d.Id(), "secret") {
+		t.Errorf("Expected the id to leave out the password, but got %s", d.Id())
+	}
+}
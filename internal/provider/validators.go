@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -28,6 +29,22 @@ func validateIntegerGeqThan(threshold int) schema.SchemaValidateDiagFunc {
 	}
 }
 
+func validateIntegerIsOneOf(values ...int) schema.SchemaValidateDiagFunc {
+	return func(v interface{}, p cty.Path) diag.Diagnostics {
+		value := v.(int)
+		for _, allowed := range values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("'%v' is not one of %v", value, values),
+			Detail:   fmt.Sprintf("'%v' is not one of %v", value, values),
+		}}
+	}
+}
+
 func validateStringIsFloatRatio() schema.SchemaValidateDiagFunc {
 	return func(v interface{}, p cty.Path) diag.Diagnostics {
 		var diags diag.Diagnostics
@@ -126,6 +143,54 @@ func validateStringMatchesPattern(pattern string) schema.SchemaValidateDiagFunc
 	}
 }
 
+func validateStringIsRegex() schema.SchemaValidateDiagFunc {
+	return func(v interface{}, p cty.Path) diag.Diagnostics {
+		value := v.(string)
+		var diags diag.Diagnostics
+		if _, err := regexp.Compile(value); err != nil {
+			diag := diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("'%v' is not a valid regular expression", value),
+				Detail:   fmt.Sprintf("'%v' is not a valid regular expression: %s", value, err),
+			}
+			diags = append(diags, diag)
+		}
+		return diags
+	}
+}
+
+func validateStringIsVersionConstraint() schema.SchemaValidateDiagFunc {
+	return func(v interface{}, p cty.Path) diag.Diagnostics {
+		value := v.(string)
+		var diags diag.Diagnostics
+		if _, err := version.NewConstraint(value); err != nil {
+			diag := diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("'%v' is not a valid version constraint", value),
+				Detail:   fmt.Sprintf("'%v' is not a valid version constraint: %s", value, err),
+			}
+			diags = append(diags, diag)
+		}
+		return diags
+	}
+}
+
+func validateStringIsPublicKeyPEM() schema.SchemaValidateDiagFunc {
+	return func(v interface{}, p cty.Path) diag.Diagnostics {
+		value := v.(string)
+		var diags diag.Diagnostics
+		if _, err := parseCosignPublicKey(value); err != nil {
+			diag := diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "The value is not a PEM encoded public key",
+				Detail:   fmt.Sprintf("The value is not a PEM encoded public key: %s", err),
+			}
+			diags = append(diags, diag)
+		}
+		return diags
+	}
+}
+
 func validateStringIsBase64Encoded() schema.SchemaValidateDiagFunc {
 	return func(v interface{}, p cty.Path) diag.Diagnostics {
 		value := v.(string)
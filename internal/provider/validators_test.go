@@ -18,6 +18,32 @@ func TestValidateIntegerGeqThan0(t *testing.T) {
 	}
 }
 
+func TestValidateIntegerIsOneOf(t *testing.T) {
+	v := 2
+	if diags := validateIntegerIsOneOf(1, 2)(v, *new(cty.Path)); diags.HasError() {
+		t.Fatalf("%d should be one of 1 and 2", v)
+	}
+
+	v = 3
+	if diags := validateIntegerIsOneOf(1, 2)(v, *new(cty.Path)); !diags.HasError() {
+		t.Fatalf("%d should be invalid as it is not one of 1 and 2", v)
+	}
+}
+
+func TestValidateStringIsVersionConstraint(t *testing.T) {
+	for _, v := range []string{">= 1.2", "~> 1.4", ">= 1.2, < 2.0"} {
+		if diags := validateStringIsVersionConstraint()(v, *new(cty.Path)); diags.HasError() {
+			t.Fatalf("%v should be a valid version constraint", v)
+		}
+	}
+
+	for _, v := range []string{"", "latest", "=> 1.2"} {
+		if diags := validateStringIsVersionConstraint()(v, *new(cty.Path)); !diags.HasError() {
+			t.Fatalf("%v should be an invalid version constraint", v)
+		}
+	}
+}
+
 func TestValidateStringIsFloatRatio(t *testing.T) {
 	v := "0.9"
 	if diags := validateStringIsFloatRatio()(v, *new(cty.Path)); diags.HasError() {
@@ -83,6 +109,17 @@ func TestValidateStringMatchesPattern(t *testing.T) {
 	}
 }
 
+func TestValidateStringIsRegex(t *testing.T) {
+	v := `^v[0-9]+\.[0-9]+$`
+	if diags := validateStringIsRegex()(v, *new(cty.Path)); diags.HasError() {
+		t.Fatalf("%q should be a valid regular expression", v)
+	}
+	v = `^v[0-9+$`
+	if diags := validateStringIsRegex()(v, *new(cty.Path)); !diags.HasError() {
+		t.Fatalf("%q should NOT be a valid regular expression", v)
+	}
+}
+
 func TestValidateStringShouldBeBase64Encoded(t *testing.T) {
 	v := `YmtzbGRrc2xka3NkMjM4MQ==`
 	if diags := validateStringIsBase64Encoded()(v, *new(cty.Path)); diags.HasError() {